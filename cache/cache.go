@@ -9,9 +9,11 @@ import (
 // Cache 根据key索引的cache
 type Cache struct {
 	timeout int64
-	vars    map[string]*cacheEntry
-	ll      *list.List
-	mu      sync.RWMutex
+	//maxEntries 最多保存的条数, 0不限制.
+	maxEntries int
+	vars       map[string]*cacheEntry
+	ll         *list.List
+	mu         sync.RWMutex
 }
 
 type cacheEntry struct {
@@ -26,6 +28,14 @@ func NewCache(timeout int64) *Cache {
 	return &Cache{timeout: timeout, vars: make(map[string]*cacheEntry), ll: list.New()}
 }
 
+// SetMaxEntries 限制最多保存的条数, 超过时淘汰最早添加的, 0不限制.
+func (c *Cache) SetMaxEntries(n int) *Cache {
+	c.mu.Lock()
+	c.maxEntries = n
+	c.mu.Unlock()
+	return c
+}
+
 // Get get from cache and remove expired key.
 func (c *Cache) Get(key string) interface{} {
 	c.evict()
@@ -51,6 +61,11 @@ func (c *Cache) Add(key string, val interface{}) {
 	v := &cacheEntry{key: key, val: val, last: time.Now().Unix()}
 	v.le = c.ll.PushFront(v)
 	c.vars[key] = v
+
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		e := c.ll.Remove(c.ll.Back()).(*cacheEntry)
+		delete(c.vars, e.key)
+	}
 	c.mu.Unlock()
 
 }
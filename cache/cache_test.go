@@ -44,3 +44,19 @@ func TestCacheInactive(t *testing.T) {
 		t.Fatalf("expect not found")
 	}
 }
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := NewCache(60).SetMaxEntries(2)
+
+	c.Add("1", 1)
+	c.Add("2", 2)
+	c.Add("3", 3)
+
+	if c.Get("1") != nil {
+		t.Fatalf("expect oldest entry evicted")
+	}
+
+	if c.Get("2") != 2 || c.Get("3") != 3 {
+		t.Fatalf("expect newest entries kept")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/cmd/crabgen/testdata/api"
+	"dearcode.net/crab/http/client"
+	"dearcode.net/crab/http/server"
+)
+
+var update = flag.Bool("update", false, "update testdata/api/crab_client.go")
+
+func TestGenerate(t *testing.T) {
+	output := "testdata/api/crab_client.go"
+
+	ap, err := parsePackage("testdata/api", output)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	src, err := generate(ap, genOption{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if *update {
+		if err = os.WriteFile(output, src, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	expect, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !bytes.Equal(src, expect) {
+		t.Fatalf("generated code changed, run go test -update:\n%s", src)
+	}
+
+	//生成到其它包时, 源码包中的类型需要加包名.
+	src, err = generate(ap, genOption{Package: "apiclient", Import: "dearcode.net/crab/cmd/crabgen/testdata/api", Name: "UserClient"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, s := range []string{
+		"package apiclient",
+		`"dearcode.net/crab/cmd/crabgen/testdata/api"`,
+		"func NewUserClient(",
+		"GetUser(ctx context.Context, id string, req api.UserQuery) (api.User, error)",
+		"PostUser(ctx context.Context, id string, req *api.User) (map[string]time.Time, error)",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Fatalf("expect %q in:\n%s", s, src)
+		}
+	}
+
+	if _, err = generate(ap, genOption{Package: "apiclient"}); err == nil {
+		t.Fatalf("expect error without import path")
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	c := api.NewClient(ts.URL+"/", client.New())
+	ctx := context.Background()
+
+	u, err := c.GetUser(ctx, "a b", api.UserQuery{Name: "crab", Limit: 3})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if u.ID != "a b" || u.Name != "crab" {
+		t.Fatalf("unexpected user:%+v", u)
+	}
+
+	m, err := c.PostUser(ctx, "1", &api.User{ID: "u1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := m["u1"]; !ok {
+		t.Fatalf("unexpected response:%v", m)
+	}
+
+	if err = c.DeleteUser(ctx, "1"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ss, err := c.GetStatus(ctx)
+	if err != nil || len(ss) != 1 || ss[0] != "ok" {
+		t.Fatalf("unexpected status:%v, err:%v", ss, err)
+	}
+
+	_, err = c.GetUser(ctx, "404", api.UserQuery{})
+	if re, ok := errors.Cause(err).(*client.ResponseError); !ok || re.Status != 404 {
+		t.Fatalf("expect response error, recv:%v", err)
+	}
+}
+
+func TestParseRegister(t *testing.T) {
+	dir := t.TempDir()
+	src := `package api
+
+import (
+	"encoding/gob"
+
+	srv "dearcode.net/crab/http/server"
+)
+
+type user struct{}
+
+type other struct{}
+
+func init() {
+	gob.Register(&other{})
+	srv.RegisterPath(&user{}, "/user")
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "api.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ap, err := parsePackage(dir, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//只解析server包的注册, 包括别名导入.
+	if len(ap.regs) != 1 || ap.regs[0].Type != "user" || ap.regs[0].Path != "/user" {
+		t.Fatalf("unexpected registrations:%+v", ap.regs)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+)
+
+var (
+	pathKeyExp = regexp.MustCompile(`{(\w+)}`)
+
+	//reservedArgs 生成代码中已使用的变量名.
+	reservedArgs = map[string]bool{"c": true, "ctx": true, "req": true, "resp": true, "r": true, "err": true, "url": true, "http": true, "client": true}
+)
+
+// genOption 生成参数.
+type genOption struct {
+	//Package 生成代码的包名, 为空时与源码同包.
+	Package string
+	//Import 源码包的import路径, 生成代码与源码不同包时必须指定.
+	Import string
+	//Name 客户端类型名.
+	Name string
+}
+
+type generator struct {
+	pkg       *apiPackage
+	opt       genOption
+	qualifier string
+	imports   map[string]string
+	buf       bytes.Buffer
+}
+
+// generate 根据解析结果生成客户端代码.
+func generate(ap *apiPackage, opt genOption) ([]byte, error) {
+	if opt.Name == "" {
+		opt.Name = "Client"
+	}
+
+	g := &generator{pkg: ap, opt: opt, imports: map[string]string{
+		"context":                       "",
+		"net/http":                      "",
+		"strings":                       "",
+		"dearcode.net/crab/http/client": "",
+	}}
+
+	if opt.Package == "" {
+		g.opt.Package = ap.Name
+	}
+
+	if g.opt.Package != ap.Name {
+		if opt.Import == "" {
+			return nil, errors.Errorf("import path of package %v is required", ap.Name)
+		}
+		g.qualifier = ap.Name
+		g.imports[opt.Import] = ""
+	}
+
+	eps := ap.endpoints()
+	if len(eps) == 0 {
+		return nil, errors.Errorf("no registered endpoint found in package %v", ap.Name)
+	}
+
+	var body bytes.Buffer
+	names := make(map[string]int)
+	for _, ep := range eps {
+		if err := g.method(&body, ep, names); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	g.header()
+	g.buf.Write(body.Bytes())
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, errors.Annotatef(err, "format source:\n%s", g.buf.Bytes())
+	}
+
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) header() {
+	g.printf("// Code generated by crabgen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", g.opt.Package)
+
+	var std, other []string
+	for p := range g.imports {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	g.printf("import (\n")
+	for _, p := range std {
+		g.printf("\t%s %q\n", g.imports[p], p)
+	}
+	g.printf("\n")
+	for _, p := range other {
+		g.printf("\t%s %q\n", g.imports[p], p)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// %s 由crabgen根据%s包中注册的接口生成的客户端.\n", g.opt.Name, g.pkg.Name)
+	g.printf("type %s struct {\n\thc   *client.HTTPClient\n\tbase string\n}\n\n", g.opt.Name)
+
+	g.printf("// New%s 创建客户端, base为服务地址, 如http://127.0.0.1:9000, hc为nil时使用client.New().\n", g.opt.Name)
+	g.printf("func New%s(base string, hc *client.HTTPClient) *%s {\n", g.opt.Name, g.opt.Name)
+	g.printf("\tif hc == nil {\n\t\thc = client.New()\n\t}\n")
+	g.printf("\treturn &%s{hc: hc, base: strings.TrimSuffix(base, \"/\")}\n}\n\n", g.opt.Name)
+}
+
+// method 生成一个接口方法, GET, DELETE的请求参数编码到url中, POST, PUT以json格式放到body中.
+func (g *generator) method(w *bytes.Buffer, ep endpoint, names map[string]int) error {
+	name := exportName(strings.ToLower(ep.Method)) + exportName(ep.Type)
+	if n := names[name]; n > 0 {
+		names[name]++
+		name = fmt.Sprintf("%s%d", name, n+1)
+	} else {
+		names[name] = 1
+	}
+
+	urlExpr, keys := g.pathExpr(ep.Path)
+
+	params := []string{"ctx context.Context"}
+	for _, k := range keys {
+		params = append(params, k+" string")
+	}
+
+	reqType, err := g.typeString(ep, ep.Request)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if reqType != "" {
+		params = append(params, "req "+reqType)
+	}
+
+	respType, err := g.typeString(ep, ep.Response)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	results := "error"
+	if respType != "" {
+		results = fmt.Sprintf("(%s, error)", respType)
+	}
+
+	fmt.Fprintf(w, "// %s %s %s.\n", name, ep.Method, ep.Path)
+	fmt.Fprintf(w, "func (c *%s) %s(%s) %s {\n", g.opt.Name, name, strings.Join(params, ", "), results)
+	fmt.Fprintf(w, "\tr := client.NewRequest(http.Method%s, %s)\n", exportName(strings.ToLower(ep.Method)), urlExpr)
+
+	data := "nil"
+	if reqType != "" {
+		switch ep.Method {
+		case "GET", "DELETE":
+			fmt.Fprintf(w, "\tr.SetQueryStruct(req)\n")
+		default:
+			data = "req"
+		}
+	}
+
+	if respType == "" {
+		fmt.Fprintf(w, "\treturn c.hc.DoData(ctx, r, %s, nil)\n}\n\n", data)
+		return nil
+	}
+
+	fmt.Fprintf(w, "\tvar resp %s\n", respType)
+	fmt.Fprintf(w, "\terr := c.hc.DoData(ctx, r, %s, &resp)\n", data)
+	fmt.Fprintf(w, "\treturn resp, err\n}\n\n")
+
+	return nil
+}
+
+// pathExpr 把路径中的{key}替换为参数, 返回拼接url的表达式及参数名.
+func (g *generator) pathExpr(p string) (string, []string) {
+	var parts, keys []string
+	last := 0
+	for _, m := range pathKeyExp.FindAllStringSubmatchIndex(p, -1) {
+		if m[0] > last {
+			parts = append(parts, strconv.Quote(p[last:m[0]]))
+		}
+		k := argName(p[m[2]:m[3]])
+		keys = append(keys, k)
+		parts = append(parts, "url.PathEscape("+k+")")
+		last = m[1]
+	}
+	if last < len(p) {
+		parts = append(parts, strconv.Quote(p[last:]))
+	}
+
+	if len(keys) > 0 {
+		g.imports["net/url"] = ""
+	}
+
+	return "c.base+" + strings.Join(parts, "+"), keys
+}
+
+// typeString 输出类型, 不同包时给源码包中定义的类型加上包名, 并记录引用的其它包.
+func (g *generator) typeString(ep endpoint, e ast.Expr) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+
+	var err error
+	e = g.qualify(ep, e, &err)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var buf bytes.Buffer
+	if err = printer.Fprint(&buf, token.NewFileSet(), e); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return buf.String(), nil
+}
+
+func (g *generator) qualify(ep endpoint, e ast.Expr, err *error) ast.Expr {
+	switch v := e.(type) {
+	case *ast.Ident:
+		if g.qualifier != "" && g.pkg.types[v.Name] {
+			return &ast.SelectorExpr{X: ast.NewIdent(g.qualifier), Sel: ast.NewIdent(v.Name)}
+		}
+	case *ast.StarExpr:
+		v.X = g.qualify(ep, v.X, err)
+	case *ast.ArrayType:
+		v.Elt = g.qualify(ep, v.Elt, err)
+	case *ast.MapType:
+		v.Key = g.qualify(ep, v.Key, err)
+		v.Value = g.qualify(ep, v.Value, err)
+	case *ast.SelectorExpr:
+		id, ok := v.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		if p, alias, ok := findImport(ep.file, id.Name); ok {
+			g.imports[p] = alias
+		} else {
+			*err = errors.Errorf("%v.%v: package %v not imported", ep.Type, ep.Method, id.Name)
+		}
+	}
+	return e
+}
+
+// findImport 在文件的import中查找包名对应的路径.
+func findImport(f *ast.File, name string) (string, string, bool) {
+	for _, is := range f.Imports {
+		p, _ := strconv.Unquote(is.Path.Value)
+		if is.Name != nil {
+			if is.Name.Name == name {
+				return p, name, true
+			}
+			continue
+		}
+		if path.Base(p) == name {
+			return p, "", true
+		}
+	}
+	return "", "", false
+}
+
+// argName 路径变量转为参数名.
+func argName(key string) string {
+	r := []rune(key)
+	r[0] = unicode.ToLower(r[0])
+	name := string(r)
+	if token.IsKeyword(name) || reservedArgs[name] {
+		name += "Arg"
+	}
+	return name
+}
+
+func exportName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
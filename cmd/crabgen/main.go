@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// main crabgen根据http/server中注册的struct生成基于HTTPClient的类型化客户端.
+//
+// 在注册接口的包中添加:
+//
+//	//go:generate go run dearcode.net/crab/cmd/crabgen
+//
+// 接口方法的请求及返回类型通过注释指定, 返回内容按server.Response格式解析, 类型为Data的类型:
+//
+//	//crab:request UserQuery
+//	//crab:response []User
+//	func (u *user) GET(w http.ResponseWriter, req *http.Request) {
+//
+// 路径中的{key}生成为string参数, GET, DELETE的请求参数编码到url中, POST, PUT以json格式放到body中.
+func main() {
+	dir := flag.String("dir", ".", "source package directory")
+	out := flag.String("o", "crab_client.go", "output file, relative to dir")
+	pkg := flag.String("pkg", "", "output package name, default same as source package")
+	imp := flag.String("import", "", "source package import path, required when -pkg differs")
+	name := flag.String("name", "Client", "client type name")
+	flag.Parse()
+
+	output := *out
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(*dir, output)
+	}
+
+	if err := run(*dir, output, genOption{Package: *pkg, Import: *imp, Name: *name}); err != nil {
+		fmt.Fprintf(os.Stderr, "crabgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, output string, opt genOption) error {
+	ap, err := parsePackage(dir, output)
+	if err != nil {
+		return err
+	}
+
+	src, err := generate(ap, opt)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, src, 0644)
+}
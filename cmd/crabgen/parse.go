@@ -0,0 +1,328 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/http/server"
+)
+
+const (
+	requestDirective  = "//crab:request "
+	responseDirective = "//crab:response "
+
+	//serverImport 注册路由的包.
+	serverImport = "dearcode.net/crab/http/server"
+)
+
+var (
+	registerFuncs = map[string]bool{
+		"Register":           false,
+		"RegisterMust":       false,
+		"RegisterPath":       true,
+		"RegisterPathMust":   true,
+		"RegisterPrefix":     true,
+		"RegisterPrefixMust": true,
+	}
+
+	httpMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+)
+
+// endpoint 一个注册的接口方法.
+type endpoint struct {
+	Type     string
+	Method   string
+	Path     string
+	Request  ast.Expr
+	Response ast.Expr
+	file     *ast.File
+}
+
+// registration 一次Register调用.
+type registration struct {
+	Type string
+	Path string
+}
+
+// apiPackage 解析后的包信息.
+type apiPackage struct {
+	fset    *token.FileSet
+	Name    string
+	types   map[string]bool
+	methods map[string][]endpoint
+	regs    []registration
+}
+
+// parsePackage 解析dir下的go文件(不包括测试文件及skip), 找出注册的struct及其接口方法.
+func parsePackage(dir, skip string) (*apiPackage, error) {
+	skip, _ = filepath.Abs(skip)
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		if strings.HasSuffix(fi.Name(), "_test.go") {
+			return false
+		}
+		p, _ := filepath.Abs(filepath.Join(dir, fi.Name()))
+		return p != skip
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(pkgs) != 1 {
+		return nil, errors.Errorf("expect one package in %v, found %d", dir, len(pkgs))
+	}
+
+	ap := &apiPackage{
+		fset:    fset,
+		types:   make(map[string]bool),
+		methods: make(map[string][]endpoint),
+	}
+
+	for name, pkg := range pkgs {
+		ap.Name = name
+
+		//按文件名排序, 保证生成结果稳定.
+		names := make([]string, 0, len(pkg.Files))
+		for fn := range pkg.Files {
+			names = append(names, fn)
+		}
+		sort.Strings(names)
+
+		for _, fn := range names {
+			if err = ap.parseFile(pkg.Files[fn]); err != nil {
+				return nil, errors.Annotatef(err, "file:%v", fn)
+			}
+		}
+	}
+
+	return ap, nil
+}
+
+func (ap *apiPackage) parseFile(f *ast.File) error {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					ap.types[ts.Name.Name] = true
+				}
+			}
+		case *ast.FuncDecl:
+			if err := ap.parseMethod(f, d); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	local := serverName(f)
+	if local == "" {
+		return nil
+	}
+
+	var err error
+	ast.Inspect(f, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		if call, ok := n.(*ast.CallExpr); ok {
+			err = ap.parseRegister(call, local)
+		}
+		return true
+	})
+
+	return errors.Trace(err)
+}
+
+// parseMethod 解析GET,POST,PUT,DELETE方法及其crab:request, crab:response注释.
+func (ap *apiPackage) parseMethod(f *ast.File, fd *ast.FuncDecl) error {
+	if fd.Recv == nil || len(fd.Recv.List) != 1 || !isHTTPMethod(fd.Name.Name) || !isHandlerFunc(fd.Type) {
+		return nil
+	}
+
+	rt := fd.Recv.List[0].Type
+	if se, ok := rt.(*ast.StarExpr); ok {
+		rt = se.X
+	}
+
+	id, ok := rt.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+
+	ep := endpoint{Type: id.Name, Method: fd.Name.Name, file: f}
+
+	if fd.Doc != nil {
+		for _, c := range fd.Doc.List {
+			var err error
+			switch {
+			case strings.HasPrefix(c.Text, requestDirective):
+				ep.Request, err = parser.ParseExpr(strings.TrimSpace(strings.TrimPrefix(c.Text, requestDirective)))
+			case strings.HasPrefix(c.Text, responseDirective):
+				ep.Response, err = parser.ParseExpr(strings.TrimSpace(strings.TrimPrefix(c.Text, responseDirective)))
+			}
+			if err != nil {
+				return errors.Annotatef(err, "%v %v.%v", ap.fset.Position(c.Pos()), id.Name, fd.Name.Name)
+			}
+		}
+	}
+
+	ap.methods[id.Name] = append(ap.methods[id.Name], ep)
+
+	return nil
+}
+
+// parseRegister 解析server.Register(&T{}), server.RegisterPrefix(new(T), "/path/{id}")等调用, local为server包在文件中的名字.
+func (ap *apiPackage) parseRegister(call *ast.CallExpr, local string) error {
+	var fn string
+	switch v := call.Fun.(type) {
+	case *ast.SelectorExpr:
+		//Obj不为nil的是本地变量, 不是包名.
+		x, ok := v.X.(*ast.Ident)
+		if !ok || x.Obj != nil || x.Name != local {
+			return nil
+		}
+		fn = v.Sel.Name
+	case *ast.Ident:
+		if local != "." {
+			return nil
+		}
+		fn = v.Name
+	default:
+		return nil
+	}
+
+	withPath, ok := registerFuncs[fn]
+	if !ok || len(call.Args) == 0 {
+		return nil
+	}
+
+	name := registerType(call.Args[0])
+	if name == "" {
+		return nil
+	}
+
+	reg := registration{Type: name, Path: server.NameToPath("*"+ap.Name+"."+name, 0) + "/"}
+	if withPath {
+		if len(call.Args) != 2 {
+			return nil
+		}
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return errors.Errorf("%v %v path must be a string literal", ap.fset.Position(call.Pos()), fn)
+		}
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		reg.Path = path
+	}
+
+	if !strings.HasPrefix(reg.Path, "/") {
+		reg.Path = "/" + reg.Path
+	}
+
+	ap.regs = append(ap.regs, reg)
+
+	return nil
+}
+
+// serverName 返回文件中server包的名字, 包括别名及".", 没有导入时返回空.
+func serverName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p != serverImport {
+			continue
+		}
+		if imp.Name == nil {
+			return "server"
+		}
+		if imp.Name.Name == "_" {
+			return ""
+		}
+		return imp.Name.Name
+	}
+	return ""
+}
+
+// endpoints 返回所有注册的接口, 按注册顺序及方法排序.
+func (ap *apiPackage) endpoints() []endpoint {
+	var eps []endpoint
+	for _, reg := range ap.regs {
+		ms := ap.methods[reg.Type]
+		for _, m := range httpMethods {
+			for _, ep := range ms {
+				if ep.Method == m {
+					ep.Path = reg.Path
+					eps = append(eps, ep)
+				}
+			}
+		}
+	}
+	return eps
+}
+
+// registerType 解析&T{}或new(T)中的类型名.
+func registerType(e ast.Expr) string {
+	switch v := e.(type) {
+	case *ast.UnaryExpr:
+		if cl, ok := v.X.(*ast.CompositeLit); ok && v.Op == token.AND {
+			if id, ok := cl.Type.(*ast.Ident); ok {
+				return id.Name
+			}
+		}
+	case *ast.CallExpr:
+		if id, ok := v.Fun.(*ast.Ident); ok && id.Name == "new" && len(v.Args) == 1 {
+			if ta, ok := v.Args[0].(*ast.Ident); ok {
+				return ta.Name
+			}
+		}
+	}
+	return ""
+}
+
+func isHTTPMethod(name string) bool {
+	for _, m := range httpMethods {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isHandlerFunc 参数为(http.ResponseWriter, *http.Request).
+func isHandlerFunc(ft *ast.FuncType) bool {
+	var params []ast.Expr
+	for _, p := range ft.Params.List {
+		n := len(p.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, p.Type)
+		}
+	}
+
+	if len(params) != 2 {
+		return false
+	}
+
+	if sel, ok := params[0].(*ast.SelectorExpr); !ok || sel.Sel.Name != "ResponseWriter" {
+		return false
+	}
+
+	se, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := se.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Request"
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"dearcode.net/crab/http/server"
+)
+
+// User 用户信息.
+type User struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// UserQuery 查询条件.
+type UserQuery struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+type user struct{}
+
+//crab:request UserQuery
+//crab:response User
+func (u *user) GET(w http.ResponseWriter, req *http.Request) {
+	id, _ := server.RESTValue(req, "id")
+
+	var q UserQuery
+	if err := server.ParseURLVars(req, &q); err != nil {
+		server.SendResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id == "404" {
+		server.SendResponse(w, http.StatusNotFound, "user %v not found", id)
+		return
+	}
+
+	server.SendResponseData(w, User{ID: id, Name: q.Name, Created: time.Unix(0, 0).UTC()})
+}
+
+//crab:request *User
+//crab:response map[string]time.Time
+func (u *user) POST(w http.ResponseWriter, req *http.Request) {
+	var nu User
+	if err := server.UnmarshalJSON(req, &nu); err != nil {
+		server.SendResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	server.SendResponseData(w, map[string]time.Time{nu.ID: time.Unix(1, 0).UTC()})
+}
+
+func (u *user) DELETE(w http.ResponseWriter, req *http.Request) {
+	server.SendResponseOK(w)
+}
+
+type status struct{}
+
+//crab:response []string
+func (s *status) GET(w http.ResponseWriter, req *http.Request) {
+	server.SendResponseData(w, []string{"ok"})
+}
+
+func init() {
+	server.RegisterPrefixMust(&user{}, "/api/user/{id}")
+	server.RegisterMust(new(status))
+}
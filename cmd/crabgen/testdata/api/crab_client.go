@@ -0,0 +1,58 @@
+// Code generated by crabgen. DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dearcode.net/crab/http/client"
+)
+
+// Client 由crabgen根据api包中注册的接口生成的客户端.
+type Client struct {
+	hc   *client.HTTPClient
+	base string
+}
+
+// NewClient 创建客户端, base为服务地址, 如http://127.0.0.1:9000, hc为nil时使用client.New().
+func NewClient(base string, hc *client.HTTPClient) *Client {
+	if hc == nil {
+		hc = client.New()
+	}
+	return &Client{hc: hc, base: strings.TrimSuffix(base, "/")}
+}
+
+// GetUser GET /api/user/{id}.
+func (c *Client) GetUser(ctx context.Context, id string, req UserQuery) (User, error) {
+	r := client.NewRequest(http.MethodGet, c.base+"/api/user/"+url.PathEscape(id))
+	r.SetQueryStruct(req)
+	var resp User
+	err := c.hc.DoData(ctx, r, nil, &resp)
+	return resp, err
+}
+
+// PostUser POST /api/user/{id}.
+func (c *Client) PostUser(ctx context.Context, id string, req *User) (map[string]time.Time, error) {
+	r := client.NewRequest(http.MethodPost, c.base+"/api/user/"+url.PathEscape(id))
+	var resp map[string]time.Time
+	err := c.hc.DoData(ctx, r, req, &resp)
+	return resp, err
+}
+
+// DeleteUser DELETE /api/user/{id}.
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	r := client.NewRequest(http.MethodDelete, c.base+"/api/user/"+url.PathEscape(id))
+	return c.hc.DoData(ctx, r, nil, nil)
+}
+
+// GetStatus GET /api/status/.
+func (c *Client) GetStatus(ctx context.Context) ([]string, error) {
+	r := client.NewRequest(http.MethodGet, c.base+"/api/status/")
+	var resp []string
+	err := c.hc.DoData(ctx, r, nil, &resp)
+	return resp, err
+}
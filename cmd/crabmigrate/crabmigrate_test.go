@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestGen(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(&out, option{Driver: "mysql", Src: "testdata/model", Type: "User"}, []string{"gen"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expect := "create table if not exists `user` (\n" +
+		"  `id` bigint not null auto_increment primary key,\n" +
+		"  `user_name` varchar(255) not null,\n" +
+		"  `email` varchar(255),\n" +
+		"  `phone` varchar(255),\n" +
+		"  `attr` json not null,\n" +
+		"  `ctime` datetime not null default current_timestamp\n);\n"
+	if out.String() != expect {
+		t.Fatalf("expect:\n%s\nrecv:\n%s", expect, out.String())
+	}
+
+	if err := run(&out, option{Driver: "mysql", Src: "testdata/model", Type: "Post"}, []string{"gen"}); err == nil {
+		t.Fatalf("expect type not found")
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	for i, expect := range []string{"0001_create_user.up.sql", "0002_add_name.up.sql"} {
+		name := []string{"create_user", "add_name"}[i]
+		files, err := newMigration(dir, name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(files) != 2 || filepath.Base(files[0]) != expect {
+			t.Fatalf("expect:%v, recv:%v", expect, files)
+		}
+	}
+
+	if err := run(&bytes.Buffer{}, option{Dir: dir}, []string{"new", "bad-name"}); err == nil {
+		t.Fatalf("expect invalid name error")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/orm"
+	"dearcode.net/crab/orm/migrate"
+	//mysql
+	_ "dearcode.net/crab/orm/mysql"
+	"dearcode.net/crab/util/str"
+)
+
+// option 命令行参数.
+type option struct {
+	Driver string
+	DSN    string
+	Dir    string
+	Table  string
+	DryRun bool
+	NoLock bool
+	Src    string
+	Type   string
+	Name   string
+}
+
+var nameRegexp = regexp.MustCompile(`^\w+$`)
+
+// main crabmigrate执行orm/migrate的数据库迁移, 及根据结构体生成建表语句.
+//
+//	crabmigrate -dsn 'user:pass@tcp(127.0.0.1:3306)/db' -dir migrations up [version]
+//	crabmigrate -dsn ... down [steps]
+//	crabmigrate -dsn ... status
+//	crabmigrate -dir migrations new add_user
+//	crabmigrate -src ./model -type User [-name user] gen
+//
+// up, down支持-dry-run只输出sql. 默认只导入了mysql驱动, 其它驱动需要在自己的程序中使用orm/migrate.
+// 不支持迁移锁的数据库需要指定-no-lock.
+func main() {
+	var opt option
+	flag.StringVar(&opt.Driver, "driver", orm.DriverMySQL, "database driver")
+	flag.StringVar(&opt.DSN, "dsn", "", "data source name")
+	flag.StringVar(&opt.Dir, "dir", "migrations", "migrations directory")
+	flag.StringVar(&opt.Table, "table", migrate.DefaultTable, "schema history table")
+	flag.BoolVar(&opt.DryRun, "dry-run", false, "print sql without executing")
+	flag.BoolVar(&opt.NoLock, "no-lock", false, "migrate without lock, database not support lock")
+	flag.StringVar(&opt.Src, "src", ".", "source package directory for gen")
+	flag.StringVar(&opt.Type, "type", "", "struct type name for gen")
+	flag.StringVar(&opt.Name, "name", "", "table name for gen, default snake case of type")
+	flag.Parse()
+
+	if err := run(os.Stdout, opt, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "crabmigrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer, opt option, args []string) error {
+	if len(args) == 0 {
+		return errors.New("command required: up, down, status, new, gen")
+	}
+
+	d, err := orm.GetDialect(opt.Driver)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	switch args[0] {
+	case "new":
+		if len(args) < 2 || !nameRegexp.MatchString(args[1]) {
+			return errors.New("usage: new NAME, name only contains letters, digits and _")
+		}
+		files, err := newMigration(opt.Dir, args[1])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, f := range files {
+			fmt.Fprintln(w, f)
+		}
+		return nil
+	case "gen":
+		return gen(w, d, opt)
+	case "up", "down", "status":
+	default:
+		return errors.Errorf("unknown command:%v", args[0])
+	}
+
+	var n int64
+	if len(args) > 1 {
+		if n, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return errors.Annotatef(err, "invalid argument:%v", args[1])
+		}
+	}
+
+	ms, err := migrate.LoadDir(opt.Dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	db, err := sql.Open(d.Name(), opt.DSN)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	m := migrate.New(db, d, ms).SetTable(opt.Table)
+	if opt.DryRun {
+		m.SetDryRun(w)
+	}
+	if opt.NoLock {
+		m.SkipLock()
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up(ctx, n)
+		printDone(w, "up", done, opt.DryRun)
+		return errors.Trace(err)
+	case "down":
+		done, err := m.Down(ctx, int(n))
+		printDone(w, "down", done, opt.DryRun)
+		return errors.Trace(err)
+	}
+
+	list, err := m.Status(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, s := range list {
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%04d_%s\t%s\n", s.Version, s.Name, state)
+	}
+	return nil
+}
+
+func printDone(w io.Writer, cmd string, done []migrate.Migration, dryRun bool) {
+	if dryRun {
+		return
+	}
+	for _, m := range done {
+		fmt.Fprintf(w, "%s %04d_%s\n", cmd, m.Version, m.Name)
+	}
+}
+
+// newMigration 在dir中创建下一个版本的up, down文件.
+func newMigration(dir, name string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var last int64
+	for _, e := range entries {
+		idx := strings.Index(e.Name(), "_")
+		if idx < 1 || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		if v, err := strconv.ParseInt(e.Name()[:idx], 10, 64); err == nil && v > last {
+			last = v
+		}
+	}
+
+	var files []string
+	for _, kind := range []string{"up", "down"} {
+		file := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", last+1, name, kind))
+		if err = os.WriteFile(file, []byte(fmt.Sprintf("-- %s %s\n", name, kind)), 0644); err != nil {
+			return nil, errors.Trace(err)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// gen 输出结构体对应的建表语句.
+func gen(w io.Writer, d orm.Dialect, opt option) error {
+	if opt.Type == "" {
+		return errors.New("gen need -type")
+	}
+
+	cols, err := parseStruct(opt.Src, opt.Type)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	table := opt.Name
+	if table == "" {
+		table = str.FieldEscape(opt.Type)
+	}
+
+	sql, err := migrate.CreateTable(d, table, cols)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = fmt.Fprintf(w, "%s;\n", sql)
+	return errors.Trace(err)
+}
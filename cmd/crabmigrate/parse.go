@@ -0,0 +1,83 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/orm/migrate"
+)
+
+// parseStruct 从dir的源码中查找结构体name, 按orm的标签生成列, 自定义类型需要通过db_type指定.
+func parseStruct(dir, name string) ([]migrate.Column, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			obj := f.Scope.Lookup(name)
+			if obj == nil || obj.Kind != ast.Typ {
+				continue
+			}
+
+			ts, ok := obj.Decl.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				return nil, errors.Errorf("%v is not struct", name)
+			}
+
+			return structColumns(st)
+		}
+	}
+
+	return nil, errors.Errorf("type %v not found in %v", name, dir)
+}
+
+func structColumns(st *ast.StructType) ([]migrate.Column, error) {
+	var cols []migrate.Column
+
+	for _, f := range st.Fields.List {
+		//匿名字段不处理.
+		if len(f.Names) == 0 {
+			continue
+		}
+
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			tag = reflect.StructTag(s)
+		}
+
+		typ := types.ExprString(f.Type)
+
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				continue
+			}
+			if c, ok := migrate.ParseColumn(n.Name, typ, tag); ok {
+				cols = append(cols, c)
+			}
+		}
+	}
+
+	return cols, nil
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// User 用户.
+type User struct {
+	ID       int64
+	Name     string `db:"user_name"`
+	Email    *string
+	Phone    sql.NullString
+	Attr     map[string]string `db:",json"`
+	Ctime    time.Time         `db_default:"now()"`
+	Skip     string            `db_ignore:""`
+	password string
+}
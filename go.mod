@@ -7,6 +7,7 @@ require (
 	github.com/google/btree v1.1.2
 	github.com/hokaccha/go-prettyjson v0.0.0-20211117102719-0474bc63780f
 	github.com/juju/errors v1.0.0
+	github.com/mattn/go-sqlite3 v1.14.17
 	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0
 )
 
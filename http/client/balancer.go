@@ -0,0 +1,348 @@
+package client
+
+import (
+	"crypto/tls"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Endpoint 服务实例, 记录进行中的请求数及连续失败次数.
+type Endpoint struct {
+	Addr        string
+	outstanding int64
+	failures    int
+	ejectUntil  time.Time
+}
+
+// Outstanding 进行中的请求数.
+func (e *Endpoint) Outstanding() int64 {
+	return atomic.LoadInt64(&e.outstanding)
+}
+
+// Balancer 从可用实例中选择一个.
+type Balancer interface {
+	Pick(eps []*Endpoint, req *http.Request) *Endpoint
+}
+
+// RoundRobin 轮询.
+type RoundRobin struct {
+	next uint64
+}
+
+// NewRoundRobin 创建轮询Balancer.
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+// Pick 实现Balancer.
+func (rr *RoundRobin) Pick(eps []*Endpoint, _ *http.Request) *Endpoint {
+	n := atomic.AddUint64(&rr.next, 1)
+	return eps[(n-1)%uint64(len(eps))]
+}
+
+// LeastOutstanding 选择进行中请求最少的实例, 相同时随机选择.
+type LeastOutstanding struct{}
+
+// NewLeastOutstanding 创建最少请求Balancer.
+func NewLeastOutstanding() *LeastOutstanding {
+	return &LeastOutstanding{}
+}
+
+// Pick 实现Balancer.
+func (lo *LeastOutstanding) Pick(eps []*Endpoint, _ *http.Request) *Endpoint {
+	var best *Endpoint
+	var min int64
+	same := 0
+
+	for _, e := range eps {
+		n := e.Outstanding()
+		switch {
+		case best == nil || n < min:
+			best, min, same = e, n, 1
+		case n == min:
+			//蓄水池抽样, 保证相同请求数的实例被选中的概率一样.
+			if same++; rand.Intn(same) == 0 {
+				best = e
+			}
+		}
+	}
+
+	return best
+}
+
+// ConsistentHash 一致性hash, 相同key的请求发到同一个实例, 实例变化时只影响该实例上的key.
+type ConsistentHash struct {
+	key func(*http.Request) string
+}
+
+// NewConsistentHash 创建一致性hash Balancer, key为nil时使用请求路径.
+func NewConsistentHash(key func(*http.Request) string) *ConsistentHash {
+	if key == nil {
+		key = func(req *http.Request) string {
+			return req.URL.Path
+		}
+	}
+	return &ConsistentHash{key: key}
+}
+
+// Pick 实现Balancer, 使用最高随机权重(rendezvous)hash.
+func (ch *ConsistentHash) Pick(eps []*Endpoint, req *http.Request) *Endpoint {
+	key := ch.key(req)
+
+	var best *Endpoint
+	var max uint64
+	for _, e := range eps {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(e.Addr))
+		if s := h.Sum64(); best == nil || s > max {
+			best, max = e, s
+		}
+	}
+
+	return best
+}
+
+// OutlierConfig 异常实例摘除配置.
+type OutlierConfig struct {
+	//ConsecutiveFailures 连续失败(网络错误或5xx)多少次后摘除.
+	ConsecutiveFailures int
+	//EjectDuration 摘除时间, 到期后重新加入.
+	EjectDuration time.Duration
+	//MaxEjectionPercent 最多摘除实例的比例, 超过后不再摘除.
+	MaxEjectionPercent int
+}
+
+// NewOutlierConfig 默认配置, 连续失败5次摘除30秒, 最多摘除一半实例.
+func NewOutlierConfig() *OutlierConfig {
+	return &OutlierConfig{
+		ConsecutiveFailures: 5,
+		EjectDuration:       30 * time.Second,
+		MaxEjectionPercent:  50,
+	}
+}
+
+// loadBalancer 把url中的服务名替换为选中的实例地址.
+type loadBalancer struct {
+	resolver  Resolver
+	balancer  Balancer
+	outlier   *OutlierConfig
+	endpoints map[string]map[string]*Endpoint
+	//transports https服务使用的Transport, 按服务名缓存, TLS校验服务名.
+	transports map[string]*http.Transport
+	mu         sync.Mutex
+}
+
+// SetResolver 开启服务发现, url中的host为服务名时通过r解析, 由b选择实例, b为nil时轮询.
+// 不是服务名的(r返回ErrServiceNotFound)按普通域名请求.
+func (c *HTTPClient) SetResolver(r Resolver, b Balancer) *HTTPClient {
+	if b == nil {
+		b = NewRoundRobin()
+	}
+
+	lb := c.loadBalancer()
+	lb.resolver = r
+	lb.balancer = b
+	c.buildTransport()
+
+	return c
+}
+
+// SetOutlierDetection 开启异常实例摘除, cfg为nil时关闭.
+func (c *HTTPClient) SetOutlierDetection(cfg *OutlierConfig) *HTTPClient {
+	lb := c.loadBalancer()
+	lb.mu.Lock()
+	lb.outlier = cfg
+	lb.mu.Unlock()
+	return c
+}
+
+func (c *HTTPClient) loadBalancer() *loadBalancer {
+	if c.lb == nil {
+		c.lb = &loadBalancer{endpoints: make(map[string]map[string]*Endpoint)}
+	}
+	return c.lb
+}
+
+func (lb *loadBalancer) wrap(next http.RoundTripper) http.RoundTripper {
+	if lb.resolver == nil {
+		return next
+	}
+
+	//Transport配置可能已修改, 重新生成.
+	lb.mu.Lock()
+	lb.transports = nil
+	lb.mu.Unlock()
+
+	return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return lb.roundTrip(next, req)
+	})
+}
+
+func (lb *loadBalancer) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	service := req.URL.Hostname()
+
+	addrs, err := lb.resolver.Resolve(req.Context(), service)
+	if errors.Cause(err) == ErrServiceNotFound {
+		return next.RoundTrip(req)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "resolve %v", service)
+	}
+
+	e := lb.pick(service, addrs, req)
+	if e == nil {
+		return nil, errors.Errorf("no endpoint for service %v", service)
+	}
+
+	//Host头保留服务名.
+	nr := req.Clone(req.Context())
+	if nr.Host == "" {
+		nr.Host = req.URL.Host
+	}
+	nr.URL.Host = e.Addr
+
+	//https使用服务名做SNI及证书校验.
+	if t, ok := next.(*http.Transport); ok && req.URL.Scheme == "https" {
+		next = lb.tlsTransport(t, service)
+	}
+
+	atomic.AddInt64(&e.outstanding, 1)
+	resp, err := next.RoundTrip(nr)
+	if err != nil {
+		atomic.AddInt64(&e.outstanding, -1)
+	} else {
+		resp.Body = &endpointBody{ReadCloser: resp.Body, e: e}
+	}
+
+	//调用方主动取消的不计入失败.
+	if err == nil || req.Context().Err() == nil {
+		lb.report(e, err == nil && resp.StatusCode < http.StatusInternalServerError)
+	}
+
+	return resp, err
+}
+
+// tlsTransport 复制base, TLS的ServerName设置为服务名, 没有单独设置ServerName时使用.
+func (lb *loadBalancer) tlsTransport(base *http.Transport, service string) *http.Transport {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if t, ok := lb.transports[service]; ok {
+		return t
+	}
+
+	t := base.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if t.TLSClientConfig.ServerName == "" {
+		t.TLSClientConfig.ServerName = service
+	}
+
+	if lb.transports == nil {
+		lb.transports = make(map[string]*http.Transport)
+	}
+	lb.transports[service] = t
+
+	return t
+}
+
+// endpointBody 关闭body时请求才结束, 减少实例进行中的请求数.
+type endpointBody struct {
+	io.ReadCloser
+	e    *Endpoint
+	once sync.Once
+}
+
+func (b *endpointBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		atomic.AddInt64(&b.e.outstanding, -1)
+	})
+	return err
+}
+
+// pick 更新服务的实例列表, 从未摘除的实例中选择一个.
+func (lb *loadBalancer) pick(service string, addrs []string, req *http.Request) *Endpoint {
+	lb.mu.Lock()
+
+	old := lb.endpoints[service]
+	eps := make(map[string]*Endpoint, len(addrs))
+	all := make([]*Endpoint, 0, len(addrs))
+	for _, a := range addrs {
+		e, ok := old[a]
+		if !ok {
+			e = &Endpoint{Addr: a}
+		}
+		eps[a] = e
+		all = append(all, e)
+	}
+	lb.endpoints[service] = eps
+
+	now := time.Now()
+	available := make([]*Endpoint, 0, len(all))
+	for _, e := range all {
+		if now.Before(e.ejectUntil) {
+			continue
+		}
+		available = append(available, e)
+	}
+
+	lb.mu.Unlock()
+
+	//全部摘除时使用所有实例.
+	if len(available) == 0 {
+		available = all
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	return lb.balancer.Pick(available, req)
+}
+
+// report 记录结果, 连续失败达到阈值时摘除实例.
+func (lb *loadBalancer) report(e *Endpoint, success bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if success {
+		e.failures = 0
+		return
+	}
+
+	e.failures++
+	if lb.outlier == nil || e.failures < lb.outlier.ConsecutiveFailures {
+		return
+	}
+
+	now := time.Now()
+	for _, eps := range lb.endpoints {
+		if eps[e.Addr] != e {
+			continue
+		}
+
+		ejected := 0
+		for _, o := range eps {
+			if now.Before(o.ejectUntil) {
+				ejected++
+			}
+		}
+
+		if (ejected+1)*100 > len(eps)*lb.outlier.MaxEjectionPercent {
+			return
+		}
+	}
+
+	e.failures = 0
+	e.ejectUntil = now.Add(lb.outlier.EjectDuration)
+}
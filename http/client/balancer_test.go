@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newNamedServer(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, name)
+	}))
+}
+
+func TestBalancer(t *testing.T) {
+	s1, s2 := newNamedServer("s1"), newNamedServer("s2")
+	defer s2.Close()
+
+	addr := func(s *httptest.Server) string {
+		return strings.TrimPrefix(s.URL, "http://")
+	}
+
+	r := NewStaticResolver(map[string][]string{"svc": {addr(s1), addr(s2)}})
+
+	get := func(hc *HTTPClient, path string) string {
+		buf, err := hc.Get("http://svc"+path, nil, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return string(buf)
+	}
+
+	hc := New().SetResolver(r, nil)
+	if a, b := get(hc, "/"), get(hc, "/"); a == b {
+		t.Fatalf("expect round robin, recv:%v, %v", a, b)
+	}
+
+	//不是服务名的直接请求.
+	if buf, err := hc.Get(s2.URL, nil, nil); err != nil || string(buf) != "s2" {
+		t.Fatalf("expect s2, recv:%s, %v", buf, err)
+	}
+
+	hc = New().SetResolver(r, NewConsistentHash(nil))
+	for _, p := range []string{"/a", "/b", "/c"} {
+		if a, b := get(hc, p), get(hc, p); a != b {
+			t.Fatalf("expect same endpoint for %v, recv:%v, %v", p, a, b)
+		}
+	}
+
+	//s1停止后连续失败2次被摘除, 后续请求都发到s2.
+	hc = New().SetResolver(r, nil).SetOutlierDetection(&OutlierConfig{ConsecutiveFailures: 2, EjectDuration: time.Minute, MaxEjectionPercent: 50})
+	s1.Close()
+
+	failed := 0
+	for i := 0; i < 10; i++ {
+		if _, err := hc.Get("http://svc/", nil, nil); err != nil {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("expect 2 failures before ejection, recv:%v", failed)
+	}
+}
+
+func TestBalancerOutstanding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, req.Host)
+	}))
+	defer ts.Close()
+
+	hc := New().SetResolver(NewStaticResolver(map[string][]string{"svc": {strings.TrimPrefix(ts.URL, "http://")}}), nil)
+
+	resp, err := hc.Stream(context.Background(), NewRequest(http.MethodGet, "http://svc/"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	e := hc.lb.endpoints["svc"][strings.TrimPrefix(ts.URL, "http://")]
+	if n := e.Outstanding(); n != 1 {
+		t.Fatalf("expect 1 outstanding before close, recv:%v", n)
+	}
+
+	buf, _ := io.ReadAll(resp.Body)
+	resp.Close()
+	if string(buf) != "svc" {
+		t.Fatalf("expect host svc, recv:%s", buf)
+	}
+
+	if n := e.Outstanding(); n != 0 {
+		t.Fatalf("expect 0 outstanding after close, recv:%v", n)
+	}
+}
+
+func TestBalancerTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, req.TLS.ServerName)
+	}))
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	//httptest的证书包含example.com.
+	r := NewStaticResolver(map[string][]string{"example.com": {strings.TrimPrefix(ts.URL, "https://")}})
+	hc := New().TLSConfig(&tls.Config{RootCAs: pool}).SetResolver(r, nil)
+
+	buf, err := hc.Get("https://example.com/", nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(buf) != "example.com" {
+		t.Fatalf("expect server name example.com, recv:%s", buf)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	eps := []*Endpoint{{Addr: "a", outstanding: 3}, {Addr: "b", outstanding: 1}, {Addr: "c", outstanding: 2}}
+	if e := NewLeastOutstanding().Pick(eps, nil); e.Addr != "b" {
+		t.Fatalf("expect b, recv:%v", e.Addr)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.conf")
+	if err := os.WriteFile(path, []byte("# services\nuser = 127.0.0.1:1, 127.0.0.1:2\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fr, err := NewFileResolver(path, time.Millisecond)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	addrs, err := fr.Resolve(context.Background(), "user")
+	if err != nil || len(addrs) != 2 || addrs[1] != "127.0.0.1:2" {
+		t.Fatalf("unexpected addrs:%v, err:%v", addrs, err)
+	}
+
+	if _, err = fr.Resolve(context.Background(), "order"); err != ErrServiceNotFound {
+		t.Fatalf("expect ErrServiceNotFound, recv:%v", err)
+	}
+
+	if err = os.WriteFile(path, []byte("user = 127.0.0.1:3\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	time.Sleep(2 * time.Millisecond)
+
+	if addrs, _ = fr.Resolve(context.Background(), "user"); len(addrs) != 1 || addrs[0] != "127.0.0.1:3" {
+		t.Fatalf("expect reloaded addrs, recv:%v", addrs)
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	lookups := 0
+	dr := NewDNSResolver(time.Minute).Add("user", "_http._tcp.user.example.com")
+	dr.lookup = func(_ context.Context, name string) ([]*net.SRV, error) {
+		lookups++
+		return []*net.SRV{
+			{Target: "b.example.com.", Port: 80, Priority: 20},
+			{Target: "a.example.com.", Port: 8080, Priority: 10},
+		}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		addrs, err := dr.Resolve(context.Background(), "user")
+		if err != nil || len(addrs) != 1 || addrs[0] != "a.example.com:8080" {
+			t.Fatalf("unexpected addrs:%v, err:%v", addrs, err)
+		}
+	}
+
+	if lookups != 1 {
+		t.Fatalf("expect cached result, lookups:%v", lookups)
+	}
+}
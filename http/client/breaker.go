@@ -0,0 +1,244 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// BreakerState 熔断器状态.
+type BreakerState int
+
+const (
+	//BreakerClosed 正常状态, 请求全部放行.
+	BreakerClosed BreakerState = iota
+	//BreakerOpen 熔断状态, 请求直接返回错误.
+	BreakerOpen
+	//BreakerHalfOpen 半开状态, 放行少量探测请求.
+	BreakerHalfOpen
+)
+
+// String 类型转字符串
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig 熔断器配置, 每个host单独统计.
+type BreakerConfig struct {
+	//ConsecutiveFailures 连续失败多少次熔断, 0不检查.
+	ConsecutiveFailures int
+	//FailureRate 统计窗口内失败率达到多少熔断, 0不检查.
+	FailureRate float64
+	//MinRequests 统计窗口内请求数达到多少才计算失败率.
+	MinRequests int
+	//Window 失败率统计窗口.
+	Window time.Duration
+	//CoolDown 熔断多长时间后进入半开状态.
+	CoolDown time.Duration
+	//HalfOpenRequests 半开状态允许同时发出的探测请求数.
+	HalfOpenRequests int
+}
+
+// NewBreakerConfig 默认配置: 连续失败5次或10秒内至少20个请求失败率超过50%时熔断30秒.
+func NewBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		ConsecutiveFailures: 5,
+		FailureRate:         0.5,
+		MinRequests:         20,
+		Window:              10 * time.Second,
+		CoolDown:            30 * time.Second,
+		HalfOpenRequests:    1,
+	}
+}
+
+// CircuitOpenError 熔断器打开时返回的错误.
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// IsCircuitOpen 错误是否因为熔断.
+func IsCircuitOpen(err error) bool {
+	_, ok := errors.Cause(err).(*CircuitOpenError)
+	return ok
+}
+
+type circuitBreaker struct {
+	host        string
+	cfg         *BreakerConfig
+	state       BreakerState
+	consecutive int
+	total       int
+	failed      int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int
+	//generation 状态变化时加1, 之前放行的请求上报结果时忽略.
+	generation uint64
+	mu         sync.Mutex
+}
+
+// allow 判断请求是否可以发出, 返回当前的generation, 上报结果时使用.
+func (b *circuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if b.state == BreakerOpen {
+		if now.Sub(b.openedAt) < b.cfg.CoolDown {
+			return 0, &CircuitOpenError{Host: b.host, Until: b.openedAt.Add(b.cfg.CoolDown)}
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.generation++
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return 0, &CircuitOpenError{Host: b.host, Until: now.Add(b.cfg.CoolDown)}
+		}
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// report 上报请求结果, gen为allow返回的generation, 状态已经变化时忽略, ignore为true时只释放半开状态的探测名额.
+func (b *circuitBreaker) report(gen uint64, success, ignore bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.generation {
+		return
+	}
+
+	now := time.Now()
+
+	if b.state == BreakerHalfOpen {
+		b.probes--
+		if ignore {
+			return
+		}
+		if success {
+			b.reset(BreakerClosed, now)
+		} else {
+			b.trip(now)
+		}
+		return
+	}
+
+	if ignore || b.state == BreakerOpen {
+		return
+	}
+
+	if b.cfg.Window > 0 && now.Sub(b.windowStart) > b.cfg.Window {
+		b.total, b.failed, b.windowStart = 0, 0, now
+	}
+
+	b.total++
+	if success {
+		b.consecutive = 0
+		return
+	}
+
+	b.failed++
+	b.consecutive++
+
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.trip(now)
+		return
+	}
+
+	if b.cfg.FailureRate > 0 && b.total >= b.cfg.MinRequests && float64(b.failed)/float64(b.total) >= b.cfg.FailureRate {
+		b.trip(now)
+	}
+}
+
+func (b *circuitBreaker) trip(now time.Time) {
+	b.reset(BreakerOpen, now)
+	b.openedAt = now
+}
+
+func (b *circuitBreaker) reset(state BreakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.consecutive, b.total, b.failed, b.probes = 0, 0, 0, 0
+	b.windowStart = now
+}
+
+type breakerGroup struct {
+	cfg      *BreakerConfig
+	breakers map[string]*circuitBreaker
+	mu       sync.Mutex
+}
+
+func (g *breakerGroup) get(rawurl string) *circuitBreaker {
+	host := rawurl
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.breakers[host]
+	if !ok {
+		b = &circuitBreaker{host: host, cfg: g.cfg, windowStart: time.Now()}
+		g.breakers[host] = b
+	}
+
+	return b
+}
+
+// SetCircuitBreaker 开启按host熔断, cfg为nil时使用默认配置.
+func (c *HTTPClient) SetCircuitBreaker(cfg *BreakerConfig) *HTTPClient {
+	if cfg == nil {
+		cfg = NewBreakerConfig()
+	}
+
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	c.breakers = &breakerGroup{cfg: cfg, breakers: make(map[string]*circuitBreaker)}
+	return c
+}
+
+// BreakerState 查询host对应熔断器状态.
+func (c HTTPClient) BreakerState(host string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+
+	c.breakers.mu.Lock()
+	b, ok := c.breakers.breakers[host]
+	c.breakers.mu.Unlock()
+	if !ok {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cfg.CoolDown {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
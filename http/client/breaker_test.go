@@ -0,0 +1,115 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	cfg := NewBreakerConfig()
+	cfg.ConsecutiveFailures = 3
+	cfg.CoolDown = 100 * time.Millisecond
+	hc := New().SetCircuitBreaker(cfg)
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	for i := 0; i < 3; i++ {
+		if _, err := hc.Get(ts.URL, nil, nil); err == nil || IsCircuitOpen(err) {
+			t.Fatalf("expect status error, recv:%v", err)
+		}
+	}
+
+	if s := hc.BreakerState(host); s != BreakerOpen {
+		t.Fatalf("expect state open, recv:%v", s)
+	}
+
+	_, err := hc.Get(ts.URL, nil, nil)
+	if !IsCircuitOpen(err) {
+		t.Fatalf("expect circuit open error, recv:%v", err)
+	}
+
+	if n := atomic.LoadInt32(&count); n != 3 {
+		t.Fatalf("expect 3 requests reach server, recv:%v", n)
+	}
+
+	time.Sleep(cfg.CoolDown)
+	if s := hc.BreakerState(host); s != BreakerHalfOpen {
+		t.Fatalf("expect state half-open, recv:%v", s)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	if _, err = hc.Get(ts.URL, nil, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if s := hc.BreakerState(host); s != BreakerClosed {
+		t.Fatalf("expect state closed, recv:%v", s)
+	}
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	b := &circuitBreaker{cfg: &BreakerConfig{FailureRate: 0.5, MinRequests: 4, Window: time.Minute, CoolDown: time.Minute, HalfOpenRequests: 1}, windowStart: time.Now()}
+
+	for _, ok := range []bool{true, false, true} {
+		b.report(0, ok, false)
+	}
+
+	if b.state != BreakerClosed {
+		t.Fatalf("expect closed before min requests, recv:%v", b.state)
+	}
+
+	b.report(0, false, false)
+	if b.state != BreakerOpen {
+		t.Fatalf("expect open, recv:%v", b.state)
+	}
+
+	if _, err := b.allow(); err == nil {
+		t.Fatalf("expect circuit open error")
+	}
+}
+
+func TestCircuitBreakerGeneration(t *testing.T) {
+	b := &circuitBreaker{cfg: &BreakerConfig{ConsecutiveFailures: 1, CoolDown: 10 * time.Millisecond, HalfOpenRequests: 1}, windowStart: time.Now()}
+
+	g1, _ := b.allow()
+	g2, _ := b.allow()
+	b.report(g1, false, false)
+	if b.state != BreakerOpen {
+		t.Fatalf("expect open, recv:%v", b.state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	g3, err := b.allow()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//熔断前放行的请求结果不影响半开状态的探测名额.
+	b.report(g2, false, false)
+	if b.state != BreakerHalfOpen || b.probes != 1 {
+		t.Fatalf("expect half-open with 1 probe, recv:%v, %v", b.state, b.probes)
+	}
+	if _, err = b.allow(); err == nil {
+		t.Fatalf("expect probe limit error")
+	}
+
+	b.report(g3, true, false)
+	if b.state != BreakerClosed {
+		t.Fatalf("expect closed, recv:%v", b.state)
+	}
+}
@@ -0,0 +1,361 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dearcode.net/crab/cache"
+)
+
+// CacheStore 缓存存储, *cache.Cache已实现该接口, Get不存在时返回nil.
+type CacheStore interface {
+	Get(key string) interface{}
+	Add(key string, val interface{})
+}
+
+const (
+	//CacheHeader 从缓存返回的结果会带上这个头, 值为HIT, REVALIDATED或STALE.
+	CacheHeader = "X-From-Cache"
+
+	//defaultCacheTimeout 默认存储的保存时间(秒).
+	defaultCacheTimeout = 3600
+	//defaultCacheMaxBody 默认可以缓存的最大body.
+	defaultCacheMaxBody = 1 << 20
+	//defaultCacheEntries 默认存储最多保存的条数.
+	defaultCacheEntries = 1024
+)
+
+// noCacheKey Stream等流式请求在ctx中设置该key, 不经过缓存.
+type noCacheKey struct{}
+
+// httpCache 按Cache-Control, ETag, Last-Modified缓存GET, HEAD请求的结果.
+type httpCache struct {
+	store   CacheStore
+	maxBody int64
+}
+
+// cachedResponse 缓存的返回结果, 保存后不再修改.
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	//received 收到返回的时间减去Age.
+	received     time.Time
+	maxAge       time.Duration
+	staleIfError time.Duration
+	noCache      bool
+	//shared 可以返回给带Authorization的请求.
+	shared bool
+	vary   map[string]string
+}
+
+// EnableCache 开启返回结果缓存, 只缓存GET, HEAD请求, store为nil时使用cache.Cache.
+// 默认的cache.Cache最多保存1024条, 每条保存1小时, 单条body不超过SetCacheMaxBody设置的大小(默认1MB).
+// 缓存位于拦截器与http.Transport之间, Vary可以匹配拦截器添加的请求头, Stream及Download不使用缓存.
+// 带Authorization的请求只缓存public或s-maxage的结果, private的结果不缓存.
+func (c *HTTPClient) EnableCache(store CacheStore) *HTTPClient {
+	if store == nil {
+		store = cache.NewCache(defaultCacheTimeout).SetMaxEntries(defaultCacheEntries)
+	}
+	c.cache = &httpCache{store: store, maxBody: defaultCacheMaxBody}
+	c.buildTransport()
+	return c
+}
+
+// SetCacheMaxBody 设置可以缓存的最大body, 超过的结果直接返回, 需要在EnableCache之后调用.
+func (c *HTTPClient) SetCacheMaxBody(n int64) *HTTPClient {
+	if c.cache != nil {
+		c.cache.maxBody = n
+	}
+	return c
+}
+
+func (hc *httpCache) wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return hc.roundTrip(next, req)
+	})
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// parseCacheControl 解析Cache-Control, 没有值的指令值为空.
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(d, "=")
+			cc[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return cc
+}
+
+func ccSeconds(cc map[string]string, key string) (time.Duration, bool) {
+	v, ok := cc[key]
+	if !ok {
+		return 0, false
+	}
+	s, err := strconv.Atoi(v)
+	if err != nil || s < 0 {
+		return 0, false
+	}
+	return time.Duration(s) * time.Second, true
+}
+
+func (hc *httpCache) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := next.RoundTrip(req)
+		//修改类请求成功后, 同一url已有的缓存失效.
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			hc.invalidate(http.MethodGet + " " + req.URL.String())
+			hc.invalidate(http.MethodHead + " " + req.URL.String())
+		}
+		return resp, err
+	}
+
+	if req.Context().Value(noCacheKey{}) != nil {
+		return next.RoundTrip(req)
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return next.RoundTrip(req)
+	}
+
+	//调用方自己设置了条件请求, 由调用方处理304.
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return next.RoundTrip(req)
+	}
+
+	cr, _ := hc.store.Get(key).(*cachedResponse)
+	if cr != nil && (!cr.varyMatch(req) || (!cr.shared && req.Header.Get("Authorization") != "")) {
+		cr = nil
+	}
+
+	if cr != nil {
+		_, noCache := reqCC["no-cache"]
+		if ma, ok := ccSeconds(reqCC, "max-age"); ok && cr.age() > ma {
+			noCache = true
+		}
+		if !noCache && cr.fresh() {
+			return cr.response(req, "HIT"), nil
+		}
+	}
+
+	creq := req
+	if cr != nil {
+		creq = req.Clone(req.Context())
+		if etag := cr.header.Get("ETag"); etag != "" {
+			creq.Header.Set("If-None-Match", etag)
+		}
+		if lm := cr.header.Get("Last-Modified"); lm != "" {
+			creq.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := next.RoundTrip(creq)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		if cr != nil && cr.staleUsable() {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return cr.response(req, "STALE"), nil
+		}
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cr != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		//304中的头覆盖缓存的头, 并重新计算有效期.
+		header := cr.header.Clone()
+		for k, vs := range resp.Header {
+			header[k] = vs
+		}
+
+		nr := newCachedResponse(req, cr.status, header, cr.body)
+		if nr == nil {
+			hc.store.Add(key, nil)
+			return cr.response(req, "REVALIDATED"), nil
+		}
+		hc.store.Add(key, nr)
+		return nr.response(req, "REVALIDATED"), nil
+	}
+
+	if !cacheableStatus(resp.StatusCode) {
+		return resp, nil
+	}
+
+	//body过大时不缓存, 已经读出的部分与剩余部分拼接后返回.
+	if resp.ContentLength > hc.maxBody {
+		if cr != nil {
+			hc.store.Add(key, nil)
+		}
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, hc.maxBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > hc.maxBody {
+		if cr != nil {
+			hc.store.Add(key, nil)
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if nr := newCachedResponse(req, resp.StatusCode, resp.Header, body); nr != nil {
+		hc.store.Add(key, nr)
+	} else if cr != nil {
+		hc.store.Add(key, nil)
+	}
+
+	return resp, nil
+}
+
+// invalidate 只清除已存在的缓存, 避免没有缓存过的url占用存储.
+func (hc *httpCache) invalidate(key string) {
+	if hc.store.Get(key) != nil {
+		hc.store.Add(key, nil)
+	}
+}
+
+func cacheableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// newCachedResponse 根据返回头生成缓存, 不能缓存时返回nil.
+func newCachedResponse(req *http.Request, status int, header http.Header, body []byte) *cachedResponse {
+	cc := parseCacheControl(header)
+	if _, ok := cc["no-store"]; ok {
+		return nil
+	}
+	if _, ok := cc["private"]; ok {
+		return nil
+	}
+
+	_, public := cc["public"]
+	_, sMaxAge := cc["s-maxage"]
+	shared := public || sMaxAge
+	if !shared && req.Header.Get("Authorization") != "" {
+		return nil
+	}
+
+	cr := &cachedResponse{
+		status:   status,
+		header:   header.Clone(),
+		body:     body,
+		received: time.Now(),
+		shared:   shared,
+		vary:     make(map[string]string),
+	}
+
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		cr.received = cr.received.Add(-time.Duration(age) * time.Second)
+	}
+
+	_, cr.noCache = cc["no-cache"]
+	cr.staleIfError, _ = ccSeconds(cc, "stale-if-error")
+
+	hasFresh := false
+	if ma, ok := ccSeconds(cc, "max-age"); ok {
+		cr.maxAge, hasFresh = ma, true
+	} else if exp := header.Get("Expires"); exp != "" {
+		hasFresh = true
+		if et, err := http.ParseTime(exp); err == nil {
+			now := time.Now()
+			if dt, err := http.ParseTime(header.Get("Date")); err == nil {
+				now = dt
+			}
+			if d := et.Sub(now); d > 0 {
+				cr.maxAge = d
+			}
+		}
+	}
+
+	//没有有效期也没有校验信息的不缓存.
+	if !hasFresh && header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return nil
+	}
+
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = http.CanonicalHeaderKey(strings.TrimSpace(f))
+			if f == "*" {
+				return nil
+			}
+			if f != "" {
+				cr.vary[f] = strings.Join(req.Header.Values(f), ",")
+			}
+		}
+	}
+
+	return cr
+}
+
+func (cr *cachedResponse) age() time.Duration {
+	return time.Since(cr.received)
+}
+
+func (cr *cachedResponse) fresh() bool {
+	return !cr.noCache && cr.age() < cr.maxAge
+}
+
+// staleUsable 请求失败时在stale-if-error时间内可以使用过期的结果.
+func (cr *cachedResponse) staleUsable() bool {
+	return cr.staleIfError > 0 && cr.age() < cr.maxAge+cr.staleIfError
+}
+
+func (cr *cachedResponse) varyMatch(req *http.Request) bool {
+	for k, v := range cr.vary {
+		if strings.Join(req.Header.Values(k), ",") != v {
+			return false
+		}
+	}
+	return true
+}
+
+// response 生成新的http.Response, 每次返回独立的header及body.
+func (cr *cachedResponse) response(req *http.Request, state string) *http.Response {
+	header := cr.header.Clone()
+	header.Set("Age", strconv.Itoa(int(cr.age().Seconds())))
+	header.Set(CacheHeader, state)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cr.status, http.StatusText(cr.status)),
+		StatusCode:    cr.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(cr.body)),
+		ContentLength: int64(len(cr.body)),
+		Request:       req,
+	}
+}
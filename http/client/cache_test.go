@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"dearcode.net/crab/cache"
+)
+
+func TestCacheMaxAge(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch req.URL.Path {
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "X-User")
+			fmt.Fprintf(w, "%v:", req.Header.Get("X-User"))
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		if req.Method == http.MethodPost {
+			return
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer ts.Close()
+
+	hc := New().EnableCache(cache.NewCache(60))
+	get := func(path string, headers map[string]string) string {
+		buf, err := hc.Get(ts.URL+path, headers, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return string(buf)
+	}
+
+	if a, b := get("/", nil), get("/", nil); a != "1" || b != "1" {
+		t.Fatalf("expect cached response 1, recv:%v, %v", a, b)
+	}
+
+	if a, b := get("/nostore", nil), get("/nostore", nil); a == b {
+		t.Fatalf("expect no-store not cached, recv:%v, %v", a, b)
+	}
+
+	if a, b := get("/vary", map[string]string{"X-User": "a"}), get("/vary", map[string]string{"X-User": "b"}); a == b {
+		t.Fatalf("expect vary miss, recv:%v, %v", a, b)
+	}
+
+	if a := get("/", map[string]string{"Cache-Control": "no-cache"}); a == "1" {
+		t.Fatalf("expect request no-cache skip cache, recv:%v", a)
+	}
+
+	//POST后缓存失效.
+	before := get("/", nil)
+	if _, err := hc.Post(ts.URL+"/", nil, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if after := get("/", nil); after == before {
+		t.Fatalf("expect cache invalidated after post, recv:%v", after)
+	}
+}
+
+// countStore 记录Add次数的CacheStore.
+type countStore struct {
+	*cache.Cache
+	adds int32
+}
+
+func (cs *countStore) Add(key string, val interface{}) {
+	atomic.AddInt32(&cs.adds, 1)
+	cs.Cache.Add(key, val)
+}
+
+func TestCacheInvalidateUncached(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	store := &countStore{Cache: cache.NewCache(60)}
+	hc := New().EnableCache(store)
+
+	for i := 0; i < 10; i++ {
+		if _, err := hc.Post(fmt.Sprintf("%s/%d", ts.URL, i), nil, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	if n := atomic.LoadInt32(&store.adds); n != 0 {
+		t.Fatalf("expect no entries for uncached urls, recv:%v", n)
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	var hits, notModified int32
+	fail := int32(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache, stale-if-error=60")
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("content v1"))
+	}))
+	defer ts.Close()
+
+	var state string
+	hc := New().EnableCache(nil).Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err == nil {
+				state = resp.Header.Get(CacheHeader)
+			}
+			return resp, err
+		})
+	})
+
+	for i := 0; i < 3; i++ {
+		buf, err := hc.Get(ts.URL, nil, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(buf) != "content v1" {
+			t.Fatalf("expect content v1, recv:%s", buf)
+		}
+		if i > 0 && state != "REVALIDATED" {
+			t.Fatalf("expect revalidated, recv:%v", state)
+		}
+	}
+
+	if hits != 3 || notModified != 2 {
+		t.Fatalf("expect 3 hits 2 not modified, recv:%v, %v", hits, notModified)
+	}
+
+	//服务端出错时返回过期的缓存.
+	atomic.StoreInt32(&fail, 1)
+	buf, err := hc.Get(ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(buf) != "content v1" {
+		t.Fatalf("expect stale content, recv:%s", buf)
+	}
+}
+
+func TestCacheSkip(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch req.URL.Path {
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/large":
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprintf(w, "%0128d", 0)
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer ts.Close()
+
+	hc := New().EnableCache(nil).SetCacheMaxBody(64)
+	get := func(path string, headers map[string]string) string {
+		buf, err := hc.Get(ts.URL+path, headers, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return string(buf)
+	}
+	auth := map[string]string{"Authorization": "Bearer a"}
+
+	if a, b := get("/", auth), get("/", auth); a == b {
+		t.Fatalf("expect authorized response not cached, recv:%v, %v", a, b)
+	}
+
+	//缓存的结果不能返回给带Authorization的请求.
+	if a, b := get("/", nil), get("/", auth); a == b {
+		t.Fatalf("expect authorized request skip cache, recv:%v, %v", a, b)
+	}
+
+	if a, b := get("/public", auth), get("/public", auth); a != b {
+		t.Fatalf("expect public response cached, recv:%v, %v", a, b)
+	}
+
+	if a, b := get("/private", nil), get("/private", nil); a == b {
+		t.Fatalf("expect private response not cached, recv:%v, %v", a, b)
+	}
+
+	a, b := get("/large", nil), get("/large", nil)
+	if a == b || len(a) < 129 {
+		t.Fatalf("expect large response not cached, recv:%v, %v", a, b)
+	}
+
+	before := get("/stream", nil)
+	resp, err := hc.Stream(context.Background(), NewRequest(http.MethodGet, ts.URL+"/stream"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Close()
+	buf, _ := io.ReadAll(resp.Body)
+	if string(buf) == before || resp.Header.Get(CacheHeader) != "" {
+		t.Fatalf("expect stream skip cache, recv:%s, %v", buf, resp.Header.Get(CacheHeader))
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,7 +22,15 @@ type HTTPClient struct {
 	retryTimes        int
 	ignoreStatusCheck bool //忽略http status code(返回非200的不按错误处理)继续解析返回内容
 	timeout           time.Duration
+	dialTimeout       time.Duration
+	retry             *RetryPolicy
+	breakers          *breakerGroup
 	client            http.Client
+	transport         *http.Transport
+	interceptors      []Interceptor
+	cache             *httpCache
+	lb                *loadBalancer
+	hedge             *HedgePolicy
 	logger            *log.Logger
 }
 
@@ -35,13 +44,21 @@ func (se *StatusError) Error() string {
 	return fmt.Sprintf("HTTP Status %v %s", se.Code, se.Message)
 }
 
-func (c *HTTPClient) dial(network, addr string) (net.Conn, error) {
+// dial 建立连接, 失败重试retryTimes次, 读写超时由每个请求的ctx控制, 不在连接上设置deadline, 保证连接池中的连接可以复用.
+func (c *HTTPClient) dial(ctx context.Context, network, addr string) (net.Conn, error) {
 	var conn net.Conn
 	var err error
 
+	timeout := c.dialTimeout
+	if timeout == 0 {
+		timeout = c.timeout
+	}
+
+	d := net.Dialer{Timeout: timeout, KeepAlive: defaultKeepAlive}
+
 	for i := 0; i < c.retryTimes; i++ {
-		conn, err = net.DialTimeout(network, addr, c.timeout)
-		if err == nil {
+		conn, err = d.DialContext(ctx, network, addr)
+		if err == nil || ctx.Err() != nil {
 			break
 		}
 		c.logger.Errorf("DialTimeout %s:%s error:%v retry:%v", network, addr, err, i+1)
@@ -52,19 +69,17 @@ func (c *HTTPClient) dial(network, addr string) (net.Conn, error) {
 		return nil, errors.Trace(err)
 	}
 
-	deadline := time.Now().Add(c.timeout)
-	if err = conn.SetDeadline(deadline); err != nil {
-		c.logger.Errorf("SetDeadline %s:%s", network, addr)
-		conn.Close()
-		return nil, errors.Trace(err)
-	}
-
 	return conn, nil
 }
 
 const (
-	defaultRetryTimes = 3
-	defaultTimeout    = 300
+	defaultRetryTimes          = 3
+	defaultTimeout             = 300
+	defaultKeepAlive           = 30 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 16
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
 )
 
 // New 创建一个带超时和重试控制的http client, 单位秒.
@@ -75,11 +90,20 @@ func New() *HTTPClient {
 		retryTimes: defaultRetryTimes,
 	}
 
-	hc.client.Transport = &http.Transport{Dial: hc.dial}
+	hc.transport = &http.Transport{
+		DialContext:           hc.dial,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	hc.client.Transport = hc.transport
+
 	return hc
 }
 
-// Timeout 设置超时时间，单位:秒, 默认300秒.
+// Timeout 设置超时时间，单位:秒, 默认300秒, 对每个请求单独计时.
 func (c *HTTPClient) Timeout(t int) *HTTPClient {
 	c.timeout = time.Duration(t) * time.Second
 	return c
@@ -97,131 +121,237 @@ func (c *HTTPClient) SetLogger(l *log.Logger) *HTTPClient {
 	return c
 }
 
-// RetryTimes 设置连接重试次数，默认为3次
+// RetryTimes 设置连接重试次数，默认为3次, 只重试建立连接, 请求失败重试见SetRetryPolicy.
 func (c *HTTPClient) RetryTimes(t int) *HTTPClient {
 	c.retryTimes = t
 	return c
 }
 
-func (c HTTPClient) do(method, url string, headers map[string]string, body []byte) ([]byte, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+// Do 发送请求, ctx取消或超时后请求中止, 超时时间优先使用req.Timeout, 设置了重试策略时每次尝试单独计算超时.
+func (c HTTPClient) Do(ctx context.Context, req *Request) ([]byte, error) {
+	if c.retry != nil && c.retry.Budget != nil {
+		c.retry.Budget.deposit()
+	}
+
+	for attempt := 1; ; attempt++ {
+		data, code, header, err := c.doAttempt(ctx, req)
+		if IsCircuitOpen(err) {
+			return nil, errors.Trace(err)
+		}
+
+		if !c.retry.shouldRetry(ctx, attempt, req, code, err) {
+			if err != nil {
+				return data, errors.Trace(err)
+			}
+			if !c.ignoreStatusCheck && code != http.StatusOK {
+				return data, errors.Trace(&StatusError{Code: code, Message: string(data)})
+			}
+			return data, nil
+		}
+
+		d := c.retry.backoff(attempt, header)
+		c.logger.Warningf("%v %v code:%v error:%v, retry:%v after %v", req.Method, req.URL, code, err, attempt, d)
+
+		if err = sleep(ctx, d); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+}
+
+// doBreaker 开启熔断时先检查熔断器状态, 再执行请求并上报结果, 网络错误及5xx算失败.
+func (c HTTPClient) doBreaker(ctx context.Context, req *Request) ([]byte, int, http.Header, error) {
+	if c.breakers == nil {
+		return c.doOnce(ctx, req)
+	}
+
+	b := c.breakers.get(req.URL)
+	gen, err := b.allow()
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, 0, nil, err
 	}
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	data, code, header, err := c.doOnce(ctx, req)
+
+	//调用方主动取消的不计入统计.
+	ignore := err != nil && ctx.Err() != nil
+	b.report(gen, err == nil && code < http.StatusInternalServerError, ignore)
+
+	return data, code, header, err
+}
+
+// doOnce 执行一次请求, 返回解压后的body, 状态码及返回头.
+func (c HTTPClient) doOnce(ctx context.Context, req *Request) ([]byte, int, http.Header, error) {
+	timeout := c.timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	resp, err := c.client.Do(req)
+	hr, err := req.build(ctx)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, 0, nil, err
+	}
+
+	resp, err := c.client.Do(hr)
+	if err != nil {
+		return nil, 0, nil, err
 	}
 	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, resp.StatusCode, resp.Header, err
 	}
 
 	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") || strings.Contains(resp.Header.Get("Content-Type"), "gzip") {
 		gr, err := gzip.NewReader(bytes.NewBuffer(data))
 		if err != nil {
-			return nil, errors.Trace(err)
+			return nil, resp.StatusCode, resp.Header, err
 		}
 		defer gr.Close()
 		data, err = io.ReadAll(gr)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return nil, resp.StatusCode, resp.Header, err
+		}
+	}
+
+	return data, resp.StatusCode, resp.Header, nil
+}
+
+// DoJSON 以json格式发送data(为nil时不修改body), 并解析返回结果到resp.
+func (c HTTPClient) DoJSON(ctx context.Context, req *Request, data interface{}, resp interface{}) error {
+	if data != nil {
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return errors.Trace(err)
 		}
+		req.Body = buf
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	buf, err := c.Do(ctx, req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	c.logger.Debugf("%v url:%v, req:%+v, resp:%s", req.Method, req.URL, data, buf)
+	return errors.Trace(json.Unmarshal(buf, resp))
+}
+
+// ResponseError 服务端按server.Response格式返回的Status不为0.
+type ResponseError struct {
+	Status  int
+	Message string
+}
+
+func (re *ResponseError) Error() string {
+	return fmt.Sprintf("Response Status %v %s", re.Status, re.Message)
+}
+
+// DoData 发送请求, 按server.Response格式{Status, Message, Data}解析返回, Status不为0时返回ResponseError, 否则把Data解析到resp中.
+func (c HTTPClient) DoData(ctx context.Context, req *Request, data interface{}, resp interface{}) error {
+	var r struct {
+		Status  int
+		Message string
+		Data    json.RawMessage
+	}
+
+	if err := c.DoJSON(ctx, req, data, &r); err != nil {
+		return errors.Trace(err)
 	}
 
-	if c.ignoreStatusCheck {
-		return data, nil
+	if r.Status != 0 {
+		return errors.Trace(&ResponseError{Status: r.Status, Message: r.Message})
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return data, errors.Trace(&StatusError{Code: resp.StatusCode, Message: string(data)})
+	if resp == nil || len(r.Data) == 0 {
+		return nil
 	}
 
-	return data, nil
+	return errors.Trace(json.Unmarshal(r.Data, resp))
 }
 
 // Get 发送Get请求.
 func (c HTTPClient) Get(url string, headers map[string]string, body []byte) ([]byte, error) {
-	return c.do("GET", url, headers, body)
+	return c.GetContext(context.Background(), url, headers, body)
+}
+
+// GetContext 发送Get请求, ctx取消后请求中止.
+func (c HTTPClient) GetContext(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	return c.Do(ctx, NewRequest(http.MethodGet, url).SetHeaders(headers).SetBody(body))
 }
 
 // GetJSON 发送Get请求, 并解析返回json.
 func (c HTTPClient) GetJSON(url string, headers map[string]string, resp interface{}) error {
-	buf, err := c.do("GET", url, headers, nil)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	c.logger.Debugf("url:%v, resp:%s", url, buf)
-	return errors.Trace(json.Unmarshal(buf, resp))
+	return c.GetJSONContext(context.Background(), url, headers, resp)
+}
+
+// GetJSONContext 发送Get请求, 并解析返回json.
+func (c HTTPClient) GetJSONContext(ctx context.Context, url string, headers map[string]string, resp interface{}) error {
+	return c.DoJSON(ctx, NewRequest(http.MethodGet, url).SetHeaders(headers), nil, resp)
 }
 
 // Post 发Post请求.
 func (c HTTPClient) Post(url string, headers map[string]string, body []byte) ([]byte, error) {
-	return c.do("POST", url, headers, body)
+	return c.PostContext(context.Background(), url, headers, body)
+}
+
+// PostContext 发Post请求, ctx取消后请求中止.
+func (c HTTPClient) PostContext(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	return c.Do(ctx, NewRequest(http.MethodPost, url).SetHeaders(headers).SetBody(body))
 }
 
 // PostJSON 发送json结构数据请求，并解析返回结果.
 func (c HTTPClient) PostJSON(url string, headers map[string]string, data interface{}, resp interface{}) error {
-	buf, err := json.Marshal(data)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	if headers == nil {
-		headers = make(map[string]string)
-	}
-	headers["Content-type"] = "application/json"
-
-	if buf, err = c.do("POST", url, headers, buf); err != nil {
-		return errors.Trace(err)
-	}
+	return c.PostJSONContext(context.Background(), url, headers, data, resp)
+}
 
-	c.logger.Debugf("url:%v, req:%+v, resp:%s", url, data, buf)
-	return json.Unmarshal(buf, resp)
+// PostJSONContext 发送json结构数据请求，并解析返回结果.
+func (c HTTPClient) PostJSONContext(ctx context.Context, url string, headers map[string]string, data interface{}, resp interface{}) error {
+	return c.DoJSON(ctx, NewRequest(http.MethodPost, url).SetHeaders(headers), data, resp)
 }
 
 // Put 发送put请求.
 func (c HTTPClient) Put(url string, headers map[string]string, body []byte) ([]byte, error) {
-	return c.do("PUT", url, headers, body)
+	return c.PutContext(context.Background(), url, headers, body)
+}
+
+// PutContext 发送put请求, ctx取消后请求中止.
+func (c HTTPClient) PutContext(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	return c.Do(ctx, NewRequest(http.MethodPut, url).SetHeaders(headers).SetBody(body))
 }
 
 // PutJSON 发送json请求解析返回结果.
 func (c HTTPClient) PutJSON(url string, headers map[string]string, data interface{}, resp interface{}) error {
-	buf, err := json.Marshal(data)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	if headers == nil {
-		headers = make(map[string]string)
-	}
-	headers["Content-type"] = "application/json"
+	return c.PutJSONContext(context.Background(), url, headers, data, resp)
+}
 
-	if buf, err = c.do("PUT", url, headers, buf); err != nil {
-		return errors.Trace(err)
-	}
-	c.logger.Debugf("url:%v, resp:%s", url, buf)
-	return json.Unmarshal(buf, resp)
+// PutJSONContext 发送json请求解析返回结果.
+func (c HTTPClient) PutJSONContext(ctx context.Context, url string, headers map[string]string, data interface{}, resp interface{}) error {
+	return c.DoJSON(ctx, NewRequest(http.MethodPut, url).SetHeaders(headers), data, resp)
 }
 
 // Delete 发送delete请求.
 func (c HTTPClient) Delete(url string, headers map[string]string, body []byte) ([]byte, error) {
-	return c.do("DELETE", url, headers, body)
+	return c.DeleteContext(context.Background(), url, headers, body)
+}
+
+// DeleteContext 发送delete请求, ctx取消后请求中止.
+func (c HTTPClient) DeleteContext(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	return c.Do(ctx, NewRequest(http.MethodDelete, url).SetHeaders(headers).SetBody(body))
 }
 
 // DeleteJSON 发送JSON格式delete请求, 并解析返回结果.
 func (c HTTPClient) DeleteJSON(url string, headers map[string]string, resp interface{}) error {
-	buf, err := c.do("DELETE", url, headers, nil)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	c.logger.Debugf("url:%v, resp:%s", url, buf)
-	return json.Unmarshal(buf, resp)
+	return c.DeleteJSONContext(context.Background(), url, headers, resp)
+}
+
+// DeleteJSONContext 发送JSON格式delete请求, 并解析返回结果.
+func (c HTTPClient) DeleteJSONContext(ctx context.Context, url string, headers map[string]string, resp interface{}) error {
+	return c.DoJSON(ctx, NewRequest(http.MethodDelete, url).SetHeaders(headers), nil, resp)
 }
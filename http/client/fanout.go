@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var (
+	//ErrFanOutFailed 成功的请求数不够.
+	ErrFanOutFailed = errors.New("fan-out success not enough")
+)
+
+// FanOutOption 并发请求参数.
+type FanOutOption struct {
+	//Concurrency 最大并发数, 0不限制.
+	Concurrency int
+	//MinSuccess 成功数达到后取消其它请求直接返回, 0等待全部完成.
+	MinSuccess int
+}
+
+// FanOutResult 单个请求的结果, 没有发送或被取消的Err为context.Canceled.
+type FanOutResult struct {
+	Request  *Request
+	Data     []byte
+	Err      error
+	Duration time.Duration
+}
+
+// FanOut 并发发送多个请求, 结果与reqs顺序一致.
+// 成功数少于MinSuccess(为0时全部失败)返回ErrFanOutFailed, 此时结果中仍包含成功的部分.
+func (c HTTPClient) FanOut(ctx context.Context, reqs []*Request, opt *FanOutOption) ([]FanOutResult, error) {
+	if opt == nil {
+		opt = &FanOutOption{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]FanOutResult, len(reqs))
+
+	var sem chan struct{}
+	if opt.Concurrency > 0 {
+		sem = make(chan struct{}, opt.Concurrency)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+
+	for i, req := range reqs {
+		results[i] = FanOutResult{Request: req, Err: context.Canceled}
+
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, req *Request) {
+			defer wg.Done()
+			if sem != nil {
+				defer func() { <-sem }()
+			}
+
+			begin := time.Now()
+			data, err := c.Do(ctx, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[i].Data, results[i].Err, results[i].Duration = data, err, time.Since(begin)
+			if err == nil {
+				if success++; opt.MinSuccess > 0 && success >= opt.MinSuccess {
+					cancel()
+				}
+			}
+		}(i, req)
+	}
+
+	wg.Wait()
+
+	need := opt.MinSuccess
+	if need <= 0 {
+		need = 1
+	}
+	if need > len(reqs) {
+		need = len(reqs)
+	}
+
+	if success < need {
+		return results, errors.Annotatef(ErrFanOutFailed, "success:%v, need:%v", success, need)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func TestFanOut(t *testing.T) {
+	var running, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		switch req.URL.Path {
+		case "/fail":
+			http.Error(w, "fail", http.StatusInternalServerError)
+		case "/slow":
+			select {
+			case <-req.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		default:
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(req.URL.Path))
+		}
+	}))
+	defer ts.Close()
+
+	hc := New()
+	reqs := []*Request{
+		NewRequest(http.MethodGet, ts.URL+"/a"),
+		NewRequest(http.MethodGet, ts.URL+"/fail"),
+		NewRequest(http.MethodGet, ts.URL+"/b"),
+		NewRequest(http.MethodGet, ts.URL+"/c"),
+	}
+
+	rs, err := hc.FanOut(context.Background(), reqs, &FanOutOption{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(rs[0].Data) != "/a" || rs[1].Err == nil || string(rs[3].Data) != "/c" {
+		t.Fatalf("unexpected results:%+v", rs)
+	}
+
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Fatalf("expect concurrency 2, recv:%v", p)
+	}
+
+	//达到MinSuccess后取消慢请求.
+	begin := time.Now()
+	reqs = []*Request{NewRequest(http.MethodGet, ts.URL+"/a"), NewRequest(http.MethodGet, ts.URL+"/slow")}
+	if rs, err = hc.FanOut(context.Background(), reqs, &FanOutOption{MinSuccess: 1}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if time.Since(begin) > time.Second || rs[1].Err == nil {
+		t.Fatalf("expect slow request canceled, recv:%+v", rs)
+	}
+
+	reqs = []*Request{NewRequest(http.MethodGet, ts.URL+"/fail"), NewRequest(http.MethodGet, ts.URL+"/a")}
+	if _, err = hc.FanOut(context.Background(), reqs, &FanOutOption{MinSuccess: 2}); errors.Cause(err) != ErrFanOutFailed {
+		t.Fatalf("expect ErrFanOutFailed, recv:%v", err)
+	}
+}
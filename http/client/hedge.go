@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy 对冲请求策略, 请求超过历史延迟的Percentile分位还没返回时, 再发送一个请求, 使用最先成功的结果.
+type HedgePolicy struct {
+	//Percentile 延迟分位, 如0.95.
+	Percentile float64
+	//MinDelay 最短等待时间.
+	MinDelay time.Duration
+	//MaxDelay 最长等待时间, 样本不足时使用.
+	MaxDelay time.Duration
+	//MaxHedges 最多额外发送的请求数.
+	MaxHedges int
+	//Methods 可以对冲的方法, 默认GET, HEAD.
+	Methods []string
+
+	tracker *latencyTracker
+}
+
+const (
+	//latencySamples 保存最近多少次请求的延迟.
+	latencySamples = 1000
+	//minLatencySamples 样本数少于这个值时使用MaxDelay.
+	minLatencySamples = 20
+)
+
+// NewHedgePolicy 创建对冲策略, 默认p95, 等待10毫秒到1秒, 最多额外发送1个请求.
+func NewHedgePolicy() *HedgePolicy {
+	return &HedgePolicy{
+		Percentile: 0.95,
+		MinDelay:   10 * time.Millisecond,
+		MaxDelay:   time.Second,
+		MaxHedges:  1,
+		Methods:    []string{http.MethodGet, http.MethodHead},
+	}
+}
+
+// SetHedgePolicy 开启对冲请求, 只对幂等且body可以重放的请求生效, p为nil时关闭.
+func (c *HTTPClient) SetHedgePolicy(p *HedgePolicy) *HTTPClient {
+	if p != nil && p.tracker == nil {
+		p.tracker = &latencyTracker{}
+	}
+	c.hedge = p
+	return c
+}
+
+// latencyTracker 记录最近的请求延迟.
+type latencyTracker struct {
+	samples []time.Duration
+	next    int
+	mu      sync.Mutex
+}
+
+func (lt *latencyTracker) add(d time.Duration) {
+	lt.mu.Lock()
+	if len(lt.samples) < latencySamples {
+		lt.samples = append(lt.samples, d)
+	} else {
+		lt.samples[lt.next] = d
+		lt.next = (lt.next + 1) % latencySamples
+	}
+	lt.mu.Unlock()
+}
+
+// percentile 返回p分位延迟, 样本不足时返回false.
+func (lt *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	lt.mu.Lock()
+	if len(lt.samples) < minLatencySamples {
+		lt.mu.Unlock()
+		return 0, false
+	}
+	ss := append([]time.Duration(nil), lt.samples...)
+	lt.mu.Unlock()
+
+	sort.Slice(ss, func(i, j int) bool { return ss[i] < ss[j] })
+
+	i := int(float64(len(ss)) * p)
+	if i >= len(ss) {
+		i = len(ss) - 1
+	}
+	return ss[i], true
+}
+
+// delay 计算发送对冲请求前的等待时间.
+func (p *HedgePolicy) delay() time.Duration {
+	d, ok := p.tracker.percentile(p.Percentile)
+	if !ok {
+		d = p.MaxDelay
+	}
+	if d < p.MinDelay {
+		d = p.MinDelay
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+func (p *HedgePolicy) applicable(req *Request) bool {
+	if p == nil || p.MaxHedges < 1 || !req.replayable() {
+		return false
+	}
+	for _, m := range p.Methods {
+		if m == req.Method {
+			return true
+		}
+	}
+	return false
+}
+
+type attemptResult struct {
+	data   []byte
+	code   int
+	header http.Header
+	err    error
+}
+
+func (r attemptResult) success() bool {
+	return r.err == nil && r.code < http.StatusInternalServerError
+}
+
+// doAttempt 执行一次尝试, 开启对冲时可能并发发送多个请求.
+func (c HTTPClient) doAttempt(ctx context.Context, req *Request) ([]byte, int, http.Header, error) {
+	if !c.hedge.applicable(req) {
+		return c.doBreaker(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, c.hedge.MaxHedges+1)
+	send := func() {
+		begin := time.Now()
+		data, code, header, err := c.doBreaker(ctx, req)
+		r := attemptResult{data: data, code: code, header: header, err: err}
+		if r.success() {
+			c.hedge.tracker.add(time.Since(begin))
+		}
+		results <- r
+	}
+
+	go send()
+	sent, recv := 1, 0
+
+	timer := time.NewTimer(c.hedge.delay())
+	defer timer.Stop()
+
+	var last attemptResult
+	for recv < sent {
+		select {
+		case <-timer.C:
+			if sent <= c.hedge.MaxHedges {
+				c.logger.Debugf("%v %v hedge:%v", req.Method, req.URL, sent)
+				go send()
+				sent++
+				timer.Reset(c.hedge.delay())
+			}
+		case r := <-results:
+			recv++
+			if r.success() {
+				return r.data, r.code, r.header, r.err
+			}
+			//失败不发送对冲请求, 由重试策略处理, 还有进行中的请求时继续等待.
+			last = r
+		}
+	}
+
+	return last.data, last.code, last.header, last.err
+}
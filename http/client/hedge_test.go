@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//第一个请求很慢, 对冲请求马上返回.
+		if n := atomic.AddInt32(&hits, 1); n == 1 {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			fmt.Fprint(w, "slow")
+			return
+		}
+		fmt.Fprint(w, "fast")
+	}))
+	defer ts.Close()
+
+	hc := New().SetHedgePolicy(&HedgePolicy{
+		Percentile: 0.9,
+		MinDelay:   10 * time.Millisecond,
+		MaxDelay:   50 * time.Millisecond,
+		MaxHedges:  1,
+		Methods:    []string{http.MethodGet},
+	})
+
+	begin := time.Now()
+	buf, err := hc.Get(ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(buf) != "fast" || time.Since(begin) > time.Second {
+		t.Fatalf("expect hedged response, recv:%s after %v", buf, time.Since(begin))
+	}
+
+	//POST不对冲.
+	atomic.StoreInt32(&hits, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err = hc.PostContext(ctx, ts.URL, nil, nil); err == nil {
+		t.Fatalf("expect post not hedged")
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expect 1 request, recv:%v", n)
+	}
+}
+
+func TestHedgeFailure(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	hc := New().SetHedgePolicy(&HedgePolicy{
+		MinDelay:  50 * time.Millisecond,
+		MaxDelay:  50 * time.Millisecond,
+		MaxHedges: 2,
+		Methods:   []string{http.MethodGet},
+	})
+
+	//快速失败的请求不对冲.
+	if _, err := hc.Get(ts.URL, nil, nil); err == nil {
+		t.Fatalf("expect status error")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expect 1 request, recv:%v", n)
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	p := NewHedgePolicy()
+	New().SetHedgePolicy(p)
+
+	if d := p.delay(); d != p.MaxDelay {
+		t.Fatalf("expect max delay without samples, recv:%v", d)
+	}
+
+	for i := 1; i <= 100; i++ {
+		p.tracker.add(time.Duration(i) * time.Millisecond)
+	}
+
+	if d := p.delay(); d != 96*time.Millisecond {
+		t.Fatalf("expect p95 96ms, recv:%v", d)
+	}
+}
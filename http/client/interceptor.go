@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"dearcode.net/crab/log"
+	"dearcode.net/crab/uuid"
+)
+
+// RoundTripFunc 函数形式的http.RoundTripper.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip 实现http.RoundTripper.
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Interceptor 请求拦截器, 包装下一级RoundTripper, 每次尝试(包括重试)都会执行.
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// Use 添加拦截器, 先添加的在外层, 即先处理请求后处理返回.
+func (c *HTTPClient) Use(interceptors ...Interceptor) *HTTPClient {
+	c.interceptors = append(c.interceptors, interceptors...)
+	c.buildTransport()
+	return c
+}
+
+// buildTransport 重新生成请求链, 依次为拦截器, 缓存, 负载均衡, http.Transport.
+func (c *HTTPClient) buildTransport() {
+	var rt http.RoundTripper = c.transport
+	if c.lb != nil {
+		rt = c.lb.wrap(rt)
+	}
+	if c.cache != nil {
+		rt = c.cache.wrap(rt)
+	}
+
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		rt = c.interceptors[i](rt)
+	}
+	c.client.Transport = rt
+}
+
+// BearerAuth 添加Authorization: Bearer token.
+func BearerAuth(token string) Interceptor {
+	return BearerAuthFunc(func(*http.Request) (string, error) {
+		return token, nil
+	})
+}
+
+// BearerAuthFunc 每次请求时调用f获取token, 用于token会过期刷新的场景.
+func BearerAuthFunc(f func(*http.Request) (string, error)) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			token, err := f(req)
+			if err != nil {
+				return nil, err
+			}
+
+			//RoundTripper不能修改传入的请求.
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 保存请求ID到ctx中, RequestID拦截器会把它传递给下游.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 从ctx中查找请求ID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+const (
+	//DefaultRequestIDHeader 默认请求ID头.
+	DefaultRequestIDHeader = "X-Request-Id"
+)
+
+// RequestID 传递请求ID, 请求头中已有的不修改, 否则取ctx中的, 都没有时生成新的, header为空使用X-Request-Id.
+func RequestID(header string) Interceptor {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) != "" {
+				return next.RoundTrip(req)
+			}
+
+			id, ok := RequestIDFromContext(req.Context())
+			if !ok {
+				id = uuid.String()
+			}
+
+			req = req.Clone(req.Context())
+			req.Header.Set(header, id)
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Dump 以debug级别输出请求及返回内容, body为true时包括body, 会把body读到内存中, 只用于调试.
+// 请求body通过GetBody重新获取, 不影响发送的请求, 流式上传的请求只输出头.
+func Dump(l *log.Logger, body bool) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if buf, err := httputil.DumpRequestOut(dumpRequest(req, body)); err == nil {
+				l.Debugf("request:\n%s", buf)
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				l.Debugf("%v %v error:%v", req.Method, req.URL, err)
+				return nil, err
+			}
+
+			if buf, err := httputil.DumpResponse(resp, body); err == nil {
+				l.Debugf("response:\n%s", buf)
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// dumpRequest 生成用于输出的请求, 需要body时复制请求并通过GetBody获取body.
+func dumpRequest(req *http.Request, body bool) (*http.Request, bool) {
+	if !body || req.Body == nil || req.Body == http.NoBody {
+		return req, body
+	}
+
+	if req.GetBody == nil {
+		return req, false
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		return req, false
+	}
+
+	dr := req.Clone(req.Context())
+	dr.Body = rc
+	return dr, true
+}
+
+// Metric 一次请求的统计信息.
+type Metric struct {
+	Method   string
+	Host     string
+	Path     string
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// Metrics 统计每次请求的耗时及结果, 耗时到收到返回头为止.
+func Metrics(f func(*Metric)) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			begin := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			m := &Metric{
+				Method:   req.Method,
+				Host:     req.URL.Host,
+				Path:     req.URL.Path,
+				Duration: time.Since(begin),
+				Err:      err,
+			}
+			if resp != nil {
+				m.Status = resp.StatusCode
+			}
+			f(m)
+
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"testing"
+
+	"dearcode.net/crab/log"
+)
+
+func TestInterceptors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", req.Header.Get("Authorization"), req.Header.Get("X-Request-Id"), req.Header.Get("X-Order"))
+	}))
+	defer ts.Close()
+
+	var order []string
+	mark := func(name string) Interceptor {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				req = req.Clone(req.Context())
+				req.Header.Add("X-Order", name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	var metrics []*Metric
+	var mu sync.Mutex
+
+	hc := New().Use(
+		mark("outer"),
+		BearerAuth("secret"),
+		RequestID(""),
+		Dump(log.GetLogger(), true),
+		Metrics(func(m *Metric) {
+			mu.Lock()
+			metrics = append(metrics, m)
+			mu.Unlock()
+		}),
+	).Use(mark("inner"))
+
+	ctx := WithRequestID(context.Background(), "req-9527")
+	buf, err := hc.GetContext(ctx, ts.URL+"/path", nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expect := "Bearer secret|req-9527|outer"; string(buf) != expect {
+		t.Fatalf("expect:%v, recv:%s", expect, buf)
+	}
+
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Fatalf("expect order outer,inner, recv:%v", order)
+	}
+
+	if len(metrics) != 1 || metrics[0].Status != http.StatusOK || metrics[0].Path != "/path" {
+		t.Fatalf("unexpected metrics:%+v", metrics)
+	}
+
+	//没有传入请求ID时自动生成.
+	buf, err = hc.Get(ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if parts := strings.Split(string(buf), "|"); len(parts) != 3 || parts[1] == "" {
+		t.Fatalf("expect generated request id, recv:%s", buf)
+	}
+}
+
+func TestDumpRequestBody(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader("hello"))
+	dr, ok := dumpRequest(req, true)
+	if !ok || dr == req {
+		t.Fatalf("expect cloned request with body")
+	}
+
+	if _, err := httputil.DumpRequestOut(dr, ok); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if buf, _ := io.ReadAll(req.Body); string(buf) != "hello" {
+		t.Fatalf("origin body changed, recv:%s", buf)
+	}
+
+	//无法重新获取body的请求只输出头.
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/", io.NopCloser(strings.NewReader("hello")))
+	if dr, ok = dumpRequest(req, true); ok || dr != req {
+		t.Fatalf("expect dump without body")
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// quoteEscaper 同mime/multipart, 转义Content-Disposition中的引号.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"", "\r", "%0D", "\n", "%0A")
+
+type multipartPart struct {
+	field       string
+	value       string
+	filename    string
+	path        string
+	contentType string
+	reader      io.Reader
+}
+
+// Multipart multipart/form-data构造器, 文件内容在发送时才读取, 不会全部加载到内存.
+type Multipart struct {
+	parts []multipartPart
+}
+
+// NewMultipart 创建multipart构造器.
+func NewMultipart() *Multipart {
+	return &Multipart{}
+}
+
+// AddField 添加普通表单字段.
+func (m *Multipart) AddField(name, value string) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: name, value: value})
+	return m
+}
+
+// AddFile 添加文件, 内容从r中读取.
+func (m *Multipart) AddFile(field, filename string, r io.Reader) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, filename: filename, reader: r})
+	return m
+}
+
+// AddFileWithType 添加文件并指定Content-Type.
+func (m *Multipart) AddFileWithType(field, filename, contentType string, r io.Reader) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, filename: filename, contentType: contentType, reader: r})
+	return m
+}
+
+// AddFilePath 添加本地文件, 发送时才打开.
+func (m *Multipart) AddFilePath(field, path string) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, filename: filepath.Base(path), path: path})
+	return m
+}
+
+// Reader 返回流式body及对应的Content-Type, 读取时才生成内容, 不再使用时需要Close.
+func (m *Multipart) Reader() (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(m.write(mw))
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+func (m *Multipart) write(mw *multipart.Writer) error {
+	for _, p := range m.parts {
+		if p.filename == "" {
+			if err := mw.WriteField(p.field, p.value); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+
+		if err := m.writeFile(mw, p); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(mw.Close())
+}
+
+func (m *Multipart) writeFile(mw *multipart.Writer, p multipartPart) error {
+	r := p.reader
+	if p.path != "" {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var w io.Writer
+	var err error
+
+	if p.contentType == "" {
+		w, err = mw.CreateFormFile(p.field, p.filename)
+	} else {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(p.field), quoteEscaper.Replace(p.filename)))
+		h.Set("Content-Type", p.contentType)
+		w, err = mw.CreatePart(h)
+	}
+
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = io.Copy(w, r)
+	return errors.Trace(err)
+}
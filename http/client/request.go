@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Request 单次请求参数, 支持多值header及url参数, 可以单独设置超时时间.
+type Request struct {
+	Method  string
+	URL     string
+	Query   url.Values
+	Header  http.Header
+	Body    []byte
+	Timeout time.Duration
+	//IdleTimeout Stream读取body时单次读取的最长等待时间, 0不限制.
+	IdleTimeout time.Duration
+	//BodyReader 流式body, 设置后忽略Body, 不能重放所以不会重试.
+	BodyReader io.Reader
+}
+
+// NewRequest 创建请求.
+func NewRequest(method, rawurl string) *Request {
+	return &Request{
+		Method: method,
+		URL:    rawurl,
+		Query:  make(url.Values),
+		Header: make(http.Header),
+	}
+}
+
+// AddQuery 添加url参数, 同名参数保留多个值.
+func (r *Request) AddQuery(key, val string) *Request {
+	r.Query.Add(key, val)
+	return r
+}
+
+// SetQuery 设置url参数, 覆盖同名参数.
+func (r *Request) SetQuery(key, val string) *Request {
+	r.Query.Set(key, val)
+	return r
+}
+
+// SetQueryStruct 把结构体字段添加到url参数中, 参数名与server端解析规则一致: 依次取json, db, cfg标签, 没有标签使用字段名.
+func (r *Request) SetQueryStruct(obj interface{}) *Request {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return r
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() == reflect.Struct {
+		structQuery(r.Query, rv)
+	}
+
+	return r
+}
+
+// queryName 取字段对应的参数名, 忽略标签中的omitempty等选项.
+func queryName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "db", "cfg"} {
+		if name := f.Tag.Get(tag); name != "" {
+			return strings.Split(name, ",")[0]
+		}
+	}
+	return f.Name
+}
+
+func structQuery(vals url.Values, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct {
+			structQuery(vals, fv)
+			continue
+		}
+
+		name := queryName(f)
+		if name == "-" || name == "" {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				vals.Add(name, fmt.Sprint(fv.Index(j).Interface()))
+			}
+			continue
+		}
+
+		vals.Set(name, fmt.Sprint(fv.Interface()))
+	}
+}
+
+// AddHeader 添加请求头, 同名header保留多个值.
+func (r *Request) AddHeader(key, val string) *Request {
+	r.Header.Add(key, val)
+	return r
+}
+
+// SetHeader 设置请求头, 覆盖同名header.
+func (r *Request) SetHeader(key, val string) *Request {
+	r.Header.Set(key, val)
+	return r
+}
+
+// SetHeaders 批量设置请求头, 兼容原有map[string]string格式.
+func (r *Request) SetHeaders(headers map[string]string) *Request {
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// SetBody 设置请求body.
+func (r *Request) SetBody(body []byte) *Request {
+	r.Body = body
+	return r
+}
+
+// SetBodyReader 设置流式body, 如文件, multipart.
+func (r *Request) SetBodyReader(body io.Reader) *Request {
+	r.BodyReader = body
+	return r
+}
+
+// replayable body可以重复发送.
+func (r *Request) replayable() bool {
+	return r.BodyReader == nil
+}
+
+// SetTimeout 设置本次请求超时时间, 覆盖HTTPClient的超时设置.
+func (r *Request) SetTimeout(t time.Duration) *Request {
+	r.Timeout = t
+	return r
+}
+
+// SetIdleTimeout 设置Stream读取body时单次读取的最长等待时间, 超时后请求中止.
+func (r *Request) SetIdleTimeout(t time.Duration) *Request {
+	r.IdleTimeout = t
+	return r
+}
+
+// fullURL 合并url中原有参数与Query.
+func (r *Request) fullURL() (string, error) {
+	if len(r.Query) == 0 {
+		return r.URL, nil
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	vals := u.Query()
+	for k, vs := range r.Query {
+		for _, v := range vs {
+			vals.Add(k, v)
+		}
+	}
+	u.RawQuery = vals.Encode()
+
+	return u.String(), nil
+}
+
+// build 生成http.Request.
+func (r *Request) build(ctx context.Context) (*http.Request, error) {
+	u, err := r.fullURL()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var body io.Reader = bytes.NewReader(r.Body)
+	if r.BodyReader != nil {
+		body = r.BodyReader
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, u, body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	return req, nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestQueryHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%v|%v", req.URL.RawQuery, strings.Join(req.Header.Values("X-Tag"), ","))
+	}))
+	defer ts.Close()
+
+	req := NewRequest(http.MethodGet, ts.URL+"/?a=1").
+		AddQuery("b", "2").AddQuery("b", "3").
+		AddHeader("X-Tag", "t1").AddHeader("X-Tag", "t2")
+
+	buf, err := New().Do(context.Background(), req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expect := "a=1&b=2&b=3|t1,t2"; string(buf) != expect {
+		t.Fatalf("expect:%v, recv:%s", expect, buf)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	hc := New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	if _, err := hc.GetContext(ctx, ts.URL, nil, nil); err == nil {
+		t.Fatalf("expect context deadline error")
+	}
+
+	if _, err := hc.Do(context.Background(), NewRequest(http.MethodGet, ts.URL).SetTimeout(50*time.Millisecond)); err == nil {
+		t.Fatalf("expect request timeout error")
+	}
+
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Fatalf("request not canceled in time, %v", d)
+	}
+}
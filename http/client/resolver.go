@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var (
+	//ErrServiceNotFound 不是Resolver中的服务名, 按普通域名请求.
+	ErrServiceNotFound = errors.New("service not found")
+)
+
+// Resolver 服务发现, 把服务名解析为实例地址列表(host:port).
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]string, error)
+}
+
+// StaticResolver 固定的服务地址列表.
+type StaticResolver struct {
+	services map[string][]string
+	mu       sync.RWMutex
+}
+
+// NewStaticResolver 创建固定地址的Resolver, key为服务名.
+func NewStaticResolver(services map[string][]string) *StaticResolver {
+	sr := &StaticResolver{services: make(map[string][]string)}
+	for k, v := range services {
+		sr.Set(k, v...)
+	}
+	return sr
+}
+
+// Set 设置服务地址.
+func (sr *StaticResolver) Set(service string, addrs ...string) {
+	sr.mu.Lock()
+	sr.services[service] = append([]string(nil), addrs...)
+	sr.mu.Unlock()
+}
+
+// Resolve 实现Resolver.
+func (sr *StaticResolver) Resolve(_ context.Context, service string) ([]string, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	addrs, ok := sr.services[service]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	return addrs, nil
+}
+
+type dnsEntry struct {
+	addrs  []string
+	expire time.Time
+}
+
+// DNSResolver 通过DNS SRV记录解析服务地址, 结果缓存ttl时间, 查询失败时继续使用过期的结果.
+type DNSResolver struct {
+	ttl     time.Duration
+	names   map[string]string
+	entries map[string]dnsEntry
+	lookup  func(ctx context.Context, name string) ([]*net.SRV, error)
+	mu      sync.Mutex
+}
+
+// NewDNSResolver 创建DNS SRV Resolver, ttl为结果缓存时间.
+func NewDNSResolver(ttl time.Duration) *DNSResolver {
+	return &DNSResolver{
+		ttl:     ttl,
+		names:   make(map[string]string),
+		entries: make(map[string]dnsEntry),
+		lookup: func(ctx context.Context, name string) ([]*net.SRV, error) {
+			_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+			return srvs, err
+		},
+	}
+}
+
+// Add 添加服务, name为SRV记录名, 如_http._tcp.user.example.com.
+func (dr *DNSResolver) Add(service, name string) *DNSResolver {
+	dr.mu.Lock()
+	dr.names[service] = name
+	dr.mu.Unlock()
+	return dr
+}
+
+// Resolve 实现Resolver, 只返回优先级最高(Priority最小)的一组地址.
+func (dr *DNSResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	dr.mu.Lock()
+	name, ok := dr.names[service]
+	e, cached := dr.entries[service]
+	dr.mu.Unlock()
+
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+
+	if cached && time.Now().Before(e.expire) {
+		return e.addrs, nil
+	}
+
+	srvs, err := dr.lookup(ctx, name)
+	if err != nil || len(srvs) == 0 {
+		if cached {
+			return e.addrs, nil
+		}
+		if err == nil {
+			err = errors.Errorf("no SRV record for %v", name)
+		}
+		return nil, errors.Trace(err)
+	}
+
+	sort.Slice(srvs, func(i, j int) bool { return srvs[i].Priority < srvs[j].Priority })
+
+	var addrs []string
+	for _, s := range srvs {
+		if s.Priority != srvs[0].Priority {
+			break
+		}
+		addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(s.Target, "."), strconv.Itoa(int(s.Port))))
+	}
+
+	dr.mu.Lock()
+	dr.entries[service] = dnsEntry{addrs: addrs, expire: time.Now().Add(dr.ttl)}
+	dr.mu.Unlock()
+
+	return addrs, nil
+}
+
+// FileResolver 从文件中读取服务地址, 文件修改后自动重新加载.
+// 文件格式每行一个服务: service = host:port, host:port, 以#或;开头的为注释.
+type FileResolver struct {
+	path     string
+	interval time.Duration
+	checked  time.Time
+	modTime  time.Time
+	services map[string][]string
+	mu       sync.Mutex
+}
+
+// NewFileResolver 创建文件Resolver, interval为检查文件是否修改的间隔.
+func NewFileResolver(path string, interval time.Duration) (*FileResolver, error) {
+	fr := &FileResolver{path: path, interval: interval}
+	if err := fr.reload(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return fr, nil
+}
+
+// reload 文件修改时间变化时重新加载, 调用方需持有fr.mu.
+func (fr *FileResolver) reload() error {
+	fr.checked = time.Now()
+
+	fi, err := os.Stat(fr.path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if fr.services != nil && fi.ModTime().Equal(fr.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(fr.path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	fr.services = parseServices(string(data))
+	fr.modTime = fi.ModTime()
+
+	return nil
+}
+
+func parseServices(body string) map[string][]string {
+	services := make(map[string][]string)
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		var addrs []string
+		for _, a := range strings.Split(v, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				addrs = append(addrs, a)
+			}
+		}
+		services[strings.TrimSpace(k)] = addrs
+	}
+	return services
+}
+
+// Resolve 实现Resolver, 重新加载失败时使用上次的结果.
+func (fr *FileResolver) Resolve(_ context.Context, service string) ([]string, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if time.Since(fr.checked) >= fr.interval {
+		fr.reload()
+	}
+
+	addrs, ok := fr.services[service]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	return addrs, nil
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// RetryPolicy 请求重试策略.
+type RetryPolicy struct {
+	//MaxAttempts 最多尝试次数(包括第一次).
+	MaxAttempts int
+	//StatusCodes 需要重试的http状态码, 默认502, 503, 504.
+	StatusCodes []int
+	//NetworkError 网络错误(连接失败, 连接被重置, 读超时等)是否重试, 默认重试.
+	NetworkError bool
+	//InitialBackoff 第一次重试等待时间, 默认100毫秒.
+	InitialBackoff time.Duration
+	//MaxBackoff 最长等待时间, 默认10秒, Retry-After也不会超过这个值.
+	MaxBackoff time.Duration
+	//Multiplier 每次重试等待时间倍数, 默认2.
+	Multiplier float64
+	//Jitter 等待时间随机浮动比例, 默认0.2, 即±20%.
+	Jitter float64
+	//RetryAfter 是否按返回的Retry-After等待, 默认是.
+	RetryAfter bool
+	//Methods 可以重试的方法, 默认只重试幂等方法: GET, HEAD, OPTIONS, PUT, DELETE, TRACE.
+	Methods []string
+	//Budget 重试预算, 为nil不限制.
+	Budget *RetryBudget
+}
+
+// NewRetryPolicy 创建默认重试策略, maxAttempts为最多尝试次数(包括第一次).
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		StatusCodes:    []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		NetworkError:   true,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryAfter:     true,
+		Methods: []string{http.MethodGet, http.MethodHead, http.MethodOptions,
+			http.MethodPut, http.MethodDelete, http.MethodTrace},
+	}
+}
+
+// SetRetryPolicy 设置请求重试策略, 与RetryTimes(只重试建立连接)相互独立.
+func (c *HTTPClient) SetRetryPolicy(p *RetryPolicy) *HTTPClient {
+	c.retry = p
+	return c
+}
+
+func (p *RetryPolicy) methodAllowed(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) statusAllowed(code int) bool {
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry 根据本次结果判断是否需要重试.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, attempt int, req *Request, code int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+
+	if !req.replayable() || !p.methodAllowed(req.Method) {
+		return false
+	}
+
+	if err != nil {
+		if !p.NetworkError || !isNetworkError(err) {
+			return false
+		}
+	} else if !p.statusAllowed(code) {
+		return false
+	}
+
+	if p.Budget != nil && !p.Budget.withdraw() {
+		return false
+	}
+
+	return true
+}
+
+// backoff 计算第attempt次重试前的等待时间, 指数退避加随机抖动.
+func (p *RetryPolicy) backoff(attempt int, header http.Header) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		d *= 1 - p.Jitter + rand.Float64()*2*p.Jitter
+	}
+
+	if p.RetryAfter && header != nil {
+		if ra, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			d = float64(ra)
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	return time.Duration(d)
+}
+
+// parseRetryAfter 解析Retry-After, 支持秒数及http时间格式.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// isNetworkError 连接失败, 连接被重置, 读写超时等, 证书错误及不支持的协议等不重试.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	//*url.Error也实现了net.Error, 需要判断其中的原始错误.
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+
+	if isTLSError(err) {
+		return false
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	var oe *net.OpError
+	//对端返回的tls alert也是*net.OpError.
+	return errors.As(err, &oe) && oe.Op != "remote error"
+}
+
+// isTLSError 证书校验失败, 握手数据错误.
+func isTLSError(err error) bool {
+	var (
+		ve *tls.CertificateVerificationError
+		re tls.RecordHeaderError
+		ua x509.UnknownAuthorityError
+		he x509.HostnameError
+		ce x509.CertificateInvalidError
+	)
+	return errors.As(err, &ve) || errors.As(err, &re) || errors.As(err, &ua) || errors.As(err, &he) || errors.As(err, &ce)
+}
+
+// sleep 等待d, ctx取消时返回错误.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
+
+// RetryBudget 重试预算, 每个请求存入ratio个令牌, 每次重试消耗一个, 防止下游故障时重试放大流量.
+type RetryBudget struct {
+	ratio  float64
+	max    float64
+	tokens float64
+	mu     sync.Mutex
+}
+
+// NewRetryBudget 创建重试预算, ratio为重试数占请求数的比例, 如0.1, max为最多累积的令牌数.
+func NewRetryBudget(ratio float64, max int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, max: float64(max), tokens: float64(max)}
+}
+
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	if b.tokens += b.ratio; b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func newFlakyServer(fails int32, code int) (*httptest.Server, *int32) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		if n > fails {
+			w.Write([]byte("ok"))
+			return
+		}
+
+		if code == 0 {
+			//模拟连接被重置.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(code)
+	}))
+	return ts, &count
+}
+
+func TestRetryStatus(t *testing.T) {
+	ts, count := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	p := NewRetryPolicy(3)
+	p.InitialBackoff = time.Millisecond
+	hc := New().SetRetryPolicy(p)
+
+	buf, err := hc.Get(ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(buf) != "ok" || atomic.LoadInt32(count) != 3 {
+		t.Fatalf("expect ok after 3 attempts, recv:%s, attempts:%v", buf, *count)
+	}
+
+	//POST不是幂等的，不重试.
+	atomic.StoreInt32(count, 0)
+	_, err = hc.Post(ts.URL, nil, []byte("data"))
+	se, ok := errors.Cause(err).(*StatusError)
+	if !ok || se.Code != http.StatusServiceUnavailable || atomic.LoadInt32(count) != 1 {
+		t.Fatalf("expect 503 without retry, recv:%v, attempts:%v", err, *count)
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	ts, count := newFlakyServer(1, 0)
+	defer ts.Close()
+
+	p := NewRetryPolicy(2)
+	p.InitialBackoff = time.Millisecond
+	hc := New().SetRetryPolicy(p)
+
+	if _, err := hc.Put(ts.URL, nil, []byte("data")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if atomic.LoadInt32(count) != 2 {
+		t.Fatalf("expect 2 attempts, recv:%v", *count)
+	}
+}
+
+func TestRetrySkipError(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	var count int32
+	p := NewRetryPolicy(3)
+	p.InitialBackoff = time.Millisecond
+	hc := New().SetRetryPolicy(p).Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&count, 1)
+			return next.RoundTrip(req)
+		})
+	})
+
+	//证书校验失败及不支持的协议不重试.
+	for _, u := range []string{ts.URL, "ftp://127.0.0.1/"} {
+		atomic.StoreInt32(&count, 0)
+		if _, err := hc.Get(u, nil, nil); err == nil {
+			t.Fatalf("%v expect error", u)
+		}
+		if n := atomic.LoadInt32(&count); n != 1 {
+			t.Fatalf("%v expect 1 attempt, recv:%v", u, n)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	ts, count := newFlakyServer(100, http.StatusBadGateway)
+	defer ts.Close()
+
+	p := NewRetryPolicy(5)
+	p.InitialBackoff = time.Millisecond
+	p.Budget = NewRetryBudget(0.1, 2)
+	hc := New().SetRetryPolicy(p)
+
+	if _, err := hc.Get(ts.URL, nil, nil); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	//预算只有2个令牌, 第一次加上2次重试.
+	if atomic.LoadInt32(count) != 3 {
+		t.Fatalf("expect 3 attempts, recv:%v", *count)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := NewRetryPolicy(5)
+	p.Jitter = 0
+
+	for i, expect := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if d := p.backoff(i+1, nil); d != expect {
+			t.Fatalf("attempt %v expect:%v, recv:%v", i+1, expect, d)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("Retry-After", "3")
+	if d := p.backoff(1, h); d != 3*time.Second {
+		t.Fatalf("expect Retry-After 3s, recv:%v", d)
+	}
+
+	h.Set("Retry-After", "3600")
+	if d := p.backoff(1, h); d != p.MaxBackoff {
+		t.Fatalf("expect max backoff, recv:%v", d)
+	}
+}
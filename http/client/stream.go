@@ -0,0 +1,159 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Response 流式请求的返回结果, Body已经解压, 读完后必须调用Close.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// Close 关闭body并释放连接.
+func (r *Response) Close() error {
+	return r.Body.Close()
+}
+
+// streamBody 关闭时同时关闭gzip reader, 原始body并取消超时ctx.
+type streamBody struct {
+	io.Reader
+	closers []io.Closer
+	cancel  context.CancelFunc
+}
+
+// idleReader 每次读取时开始计时, 超过idle没有读到数据时取消请求.
+type idleReader struct {
+	r     io.Reader
+	idle  time.Duration
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.idle)
+	n, err := r.r.Read(p)
+	r.timer.Stop()
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return err
+}
+
+const (
+	maxErrorBody = 4096
+)
+
+// Stream 发送请求并返回可以流式读取的结果, 不会重试, 超时只计算到收到返回头, 读取body不受限制.
+// 可以通过req.SetIdleTimeout限制读取body时单次读取的等待时间.
+func (c HTTPClient) Stream(ctx context.Context, req *Request) (*Response, error) {
+	var b *circuitBreaker
+	var gen uint64
+	if c.breakers != nil {
+		b = c.breakers.get(req.URL)
+		var err error
+		if gen, err = b.allow(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	timeout := c.timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+
+	//返回头超时后取消请求, 收到返回头后停止计时, 不影响读取body.
+	ctx, cancel := context.WithCancel(ctx)
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, cancel)
+	}
+
+	//流式读取的结果不缓存.
+	hr, err := req.build(context.WithValue(ctx, noCacheKey{}, true))
+	if err != nil {
+		cancel()
+		return nil, errors.Trace(err)
+	}
+
+	resp, err := c.client.Do(hr)
+	if timer != nil && !timer.Stop() {
+		//已经超时取消, 收到返回头时刚好超时的body也不能再读取.
+		if err == nil {
+			resp.Body.Close()
+		}
+		err = errors.Annotatef(context.DeadlineExceeded, "wait response header %v", timeout)
+	}
+	if b != nil {
+		b.report(gen, err == nil && resp.StatusCode < http.StatusInternalServerError, err != nil && ctx.Err() != nil)
+	}
+	if err != nil {
+		cancel()
+		return nil, errors.Trace(err)
+	}
+
+	body := &streamBody{Reader: resp.Body, closers: []io.Closer{resp.Body}, cancel: cancel}
+	if req.IdleTimeout > 0 {
+		t := time.AfterFunc(req.IdleTimeout, cancel)
+		t.Stop()
+		body.Reader = &idleReader{r: resp.Body, idle: req.IdleTimeout, timer: t}
+	}
+
+	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") || strings.Contains(resp.Header.Get("Content-Type"), "gzip") {
+		gr, err := gzip.NewReader(body.Reader)
+		if err != nil {
+			body.Close()
+			return nil, errors.Trace(err)
+		}
+		body.Reader = gr
+		body.closers = []io.Closer{gr, resp.Body}
+	}
+
+	if !c.ignoreStatusCheck && resp.StatusCode != http.StatusOK {
+		defer body.Close()
+		data, _ := io.ReadAll(io.LimitReader(body, maxErrorBody))
+		return nil, errors.Trace(&StatusError{Code: resp.StatusCode, Message: string(data)})
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// Download 下载url内容写入w, 返回写入的字节数.
+func (c HTTPClient) Download(ctx context.Context, url string, headers map[string]string, w io.Writer) (int64, error) {
+	resp, err := c.Stream(ctx, NewRequest(http.MethodGet, url).SetHeaders(headers))
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer resp.Close()
+
+	n, err := io.Copy(w, resp.Body)
+	return n, errors.Trace(err)
+}
+
+// PostMultipart 以multipart/form-data格式流式上传.
+func (c HTTPClient) PostMultipart(ctx context.Context, url string, headers map[string]string, m *Multipart) ([]byte, error) {
+	body, contentType := m.Reader()
+	//请求没有发出时也要关闭, 结束写数据的goroutine.
+	defer body.Close()
+
+	req := NewRequest(http.MethodPost, url).SetHeaders(headers).SetBodyReader(body)
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(ctx, req)
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func TestStreamDownload(t *testing.T) {
+	content := strings.Repeat("crab stream data\n", 10000)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		io.WriteString(gw, content)
+		gw.Close()
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	n, err := New().Download(context.Background(), ts.URL, map[string]string{"Accept-Encoding": "gzip"}, &buf)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if n != int64(len(content)) || buf.String() != content {
+		t.Fatalf("expect %v bytes, recv:%v", len(content), n)
+	}
+
+	_, err = New().Stream(context.Background(), NewRequest(http.MethodGet, ts.URL+"/missing"))
+	if se, ok := errors.Cause(err).(*StatusError); !ok || se.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 status error, recv:%v", err)
+	}
+}
+
+func TestStreamUpload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+			if err := req.ParseMultipartForm(1 << 20); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f, fh, err := req.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			data, _ := io.ReadAll(f)
+			p, _, _ := req.FormFile("path")
+			pd, _ := io.ReadAll(p)
+			fmt.Fprintf(w, "%s|%s|%s|%s", req.FormValue("name"), fh.Filename, data, pd)
+			return
+		}
+
+		data, _ := io.ReadAll(req.Body)
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	hc := New()
+
+	req := NewRequest(http.MethodPut, ts.URL).SetBodyReader(strings.NewReader("stream body"))
+	buf, err := hc.Do(context.Background(), req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(buf) != "stream body" {
+		t.Fatalf("expect stream body, recv:%s", buf)
+	}
+
+	path := filepath.Join(t.TempDir(), "local.txt")
+	if err = os.WriteFile(path, []byte("local file"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m := NewMultipart().
+		AddField("name", "crab").
+		AddFile("file", "a.txt", strings.NewReader("file content")).
+		AddFilePath("path", path)
+
+	if buf, err = hc.PostMultipart(context.Background(), ts.URL, nil, m); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expect := "crab|a.txt|file content|local file"; string(buf) != expect {
+		t.Fatalf("expect:%v, recv:%s", expect, buf)
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow_header" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		io.WriteString(w, "begin,")
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "end")
+	}))
+	defer ts.Close()
+
+	hc := New()
+
+	//超时只计算到收到返回头.
+	resp, err := hc.Stream(context.Background(), NewRequest(http.MethodGet, ts.URL).SetTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	buf, err := io.ReadAll(resp.Body)
+	resp.Close()
+	if err != nil || string(buf) != "begin,end" {
+		t.Fatalf("expect full body, recv:%s, err:%v", buf, err)
+	}
+
+	if _, err = hc.Stream(context.Background(), NewRequest(http.MethodGet, ts.URL+"/slow_header").SetTimeout(100*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect header timeout, recv:%v", err)
+	}
+
+	resp, err = hc.Stream(context.Background(), NewRequest(http.MethodGet, ts.URL).SetIdleTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Close()
+	if buf, err = io.ReadAll(resp.Body); err == nil {
+		t.Fatalf("expect idle timeout, recv:%s", buf)
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// MaxIdleConns 设置连接池中最多空闲连接数, 默认100.
+func (c *HTTPClient) MaxIdleConns(n int) *HTTPClient {
+	c.transport.MaxIdleConns = n
+	return c
+}
+
+// MaxIdleConnsPerHost 设置每个host最多空闲连接数, 默认16.
+func (c *HTTPClient) MaxIdleConnsPerHost(n int) *HTTPClient {
+	c.transport.MaxIdleConnsPerHost = n
+	return c
+}
+
+// MaxConnsPerHost 设置每个host最多连接数, 默认不限制.
+func (c *HTTPClient) MaxConnsPerHost(n int) *HTTPClient {
+	c.transport.MaxConnsPerHost = n
+	return c
+}
+
+// IdleConnTimeout 设置空闲连接超时时间, 默认90秒.
+func (c *HTTPClient) IdleConnTimeout(t time.Duration) *HTTPClient {
+	c.transport.IdleConnTimeout = t
+	return c
+}
+
+// TLSHandshakeTimeout 设置TLS握手超时时间, 默认10秒.
+func (c *HTTPClient) TLSHandshakeTimeout(t time.Duration) *HTTPClient {
+	c.transport.TLSHandshakeTimeout = t
+	return c
+}
+
+// ResponseHeaderTimeout 设置发送请求后等待返回头的超时时间, 默认不限制.
+func (c *HTTPClient) ResponseHeaderTimeout(t time.Duration) *HTTPClient {
+	c.transport.ResponseHeaderTimeout = t
+	return c
+}
+
+// DialTimeout 设置建立连接超时时间, 默认与Timeout相同.
+func (c *HTTPClient) DialTimeout(t time.Duration) *HTTPClient {
+	c.dialTimeout = t
+	return c
+}
+
+// Proxy 设置代理, 如http.ProxyURL(u), http.ProxyFromEnvironment.
+func (c *HTTPClient) Proxy(proxy func(*http.Request) (*url.URL, error)) *HTTPClient {
+	c.transport.Proxy = proxy
+	return c
+}
+
+// TLSConfig 设置TLS配置, 可以通过LoadTLSConfig加载证书.
+func (c *HTTPClient) TLSConfig(cfg *tls.Config) *HTTPClient {
+	c.transport.TLSClientConfig = cfg
+	c.buildTransport()
+	return c
+}
+
+// LoadTLSConfig 加载CA证书及客户端证书, 为空的参数忽略.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		buf, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, errors.Errorf("no certificate found in %v", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportKeepAlive(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	hc := New().Timeout(1).MaxIdleConnsPerHost(2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := hc.Get(ts.URL, nil, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+		//超过Timeout后连接仍然可以复用.
+		time.Sleep(1100 * time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("expect 1 connection, recv:%v", n)
+	}
+}
+
+func TestTransportTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("tls ok"))
+	}))
+	defer ts.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	buf := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(ca, buf, 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := New().Timeout(1).Get(ts.URL, nil, nil); err == nil {
+		t.Fatalf("expect unknown authority error")
+	}
+
+	cfg, err := LoadTLSConfig(ca, "", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := New().TLSConfig(cfg).Get(ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if string(data) != "tls ok" {
+		t.Fatalf("expect tls ok, recv:%s", data)
+	}
+}
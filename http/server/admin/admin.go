@@ -0,0 +1,288 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/http/server"
+	"dearcode.net/crab/log"
+)
+
+// Check 健康检查函数, 返回nil表示正常, 如orm.PingCheck(db).
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Admin 管理接口, 提供存活/就绪检查, 编译信息, 运行状态, 在线修改日志级别及pprof.
+type Admin struct {
+	prefix    string
+	liveness  []namedCheck
+	readiness []namedCheck
+	info      map[string]string
+	timeout   time.Duration
+	pprof     bool
+	started   time.Time
+	mu        sync.RWMutex
+}
+
+const (
+	defaultCheckTimeout = 5 * time.Second
+	//DefaultPrefix Mount时prefix为空使用的路径.
+	DefaultPrefix = "/debug/crab"
+)
+
+// New 创建管理接口, 需要通过Mount挂载到服务上或者Start在单独端口启动.
+func New() *Admin {
+	return &Admin{
+		info:    make(map[string]string),
+		timeout: defaultCheckTimeout,
+		started: time.Now(),
+	}
+}
+
+// AddLiveness 添加存活检查, 对应/health.
+func (a *Admin) AddLiveness(name string, c Check) *Admin {
+	a.mu.Lock()
+	a.liveness = append(a.liveness, namedCheck{name: name, check: c})
+	a.mu.Unlock()
+	return a
+}
+
+// AddReadiness 添加就绪检查, 对应/ready.
+func (a *Admin) AddReadiness(name string, c Check) *Admin {
+	a.mu.Lock()
+	a.readiness = append(a.readiness, namedCheck{name: name, check: c})
+	a.mu.Unlock()
+	return a
+}
+
+// Info 添加自定义编译信息, 如版本号, 编译时间, 对应/info.
+func (a *Admin) Info(key, val string) *Admin {
+	a.mu.Lock()
+	a.info[key] = val
+	a.mu.Unlock()
+	return a
+}
+
+// CheckTimeout 设置每个检查的超时时间, 默认5秒.
+func (a *Admin) CheckTimeout(d time.Duration) *Admin {
+	a.timeout = d
+	return a
+}
+
+// EnablePprof 开启/debug/pprof/接口.
+func (a *Admin) EnablePprof() *Admin {
+	a.pprof = true
+	return a
+}
+
+// Mount 挂载到server的prefix路径下, 如/admin, 为空时使用DefaultPrefix, 不能挂载到根路径.
+func (a *Admin) Mount(prefix string) error {
+	a.prefix = "/" + strings.Trim(prefix, "/")
+	if a.prefix == "/" {
+		a.prefix = DefaultPrefix
+	}
+
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		if err := server.RegisterPrefixHandler(a.ServeHTTP, m, a.prefix+"/"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// Start 在单独的地址上启动管理接口.
+func (a *Admin) Start(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	go func() {
+		if err = http.Serve(ln, a); err != nil {
+			log.Errorf("admin Serve error:%v", err)
+		}
+	}()
+
+	return ln, nil
+}
+
+// ServeHTTP 管理接口路由.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, a.prefix)
+
+	switch {
+	case path == "/health":
+		a.mu.RLock()
+		checks := a.liveness
+		a.mu.RUnlock()
+		a.runChecks(w, req, checks)
+	case path == "/ready":
+		a.mu.RLock()
+		checks := a.readiness
+		a.mu.RUnlock()
+		a.runChecks(w, req, checks)
+	case path == "/info":
+		a.buildInfo(w)
+	case path == "/stats":
+		a.stats(w)
+	case path == "/loglevel":
+		a.logLevel(w, req)
+	case a.pprof && strings.HasPrefix(path, "/debug/pprof/"):
+		a.servePprof(w, req, path)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func send(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	buf, _ := json.Marshal(data)
+	w.Write(buf)
+}
+
+// runChecks 并发执行检查, 有一个失败返回503.
+func (a *Admin) runChecks(w http.ResponseWriter, req *http.Request, checks []namedCheck) {
+	ctx, cancel := context.WithTimeout(req.Context(), a.timeout)
+	defer cancel()
+
+	results := make(map[string]string, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			msg := "ok"
+			if err := c.check(ctx); err != nil {
+				msg = err.Error()
+				log.Warningf("check %v error:%v", c.name, err)
+			}
+			mu.Lock()
+			results[c.name] = msg
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	status := "ok"
+	for _, msg := range results {
+		if msg != "ok" {
+			code = http.StatusServiceUnavailable
+			status = "fail"
+			break
+		}
+	}
+
+	send(w, code, map[string]interface{}{"status": status, "checks": results})
+}
+
+func (a *Admin) buildInfo(w http.ResponseWriter) {
+	info := map[string]string{
+		"go_version": runtime.Version(),
+		"start_time": a.started.Format(time.RFC3339),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info["path"] = bi.Path
+		info["version"] = bi.Main.Version
+		for _, s := range bi.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") {
+				info[s.Key] = s.Value
+			}
+		}
+	}
+
+	a.mu.RLock()
+	for k, v := range a.info {
+		info[k] = v
+	}
+	a.mu.RUnlock()
+
+	send(w, http.StatusOK, info)
+}
+
+func (a *Admin) stats(w http.ResponseWriter) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	send(w, http.StatusOK, map[string]interface{}{
+		"uptime":         time.Since(a.started).String(),
+		"goroutines":     runtime.NumGoroutine(),
+		"cpus":           runtime.NumCPU(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"alloc":          ms.Alloc,
+		"total_alloc":    ms.TotalAlloc,
+		"sys":            ms.Sys,
+		"heap_alloc":     ms.HeapAlloc,
+		"heap_inuse":     ms.HeapInuse,
+		"heap_objects":   ms.HeapObjects,
+		"num_gc":         ms.NumGC,
+		"pause_total_ns": ms.PauseTotalNs,
+	})
+}
+
+// logLevel GET查看日志级别, POST/PUT修改日志级别.
+func (a *Admin) logLevel(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		send(w, http.StatusOK, map[string]string{"level": log.GetLogLevel().String()})
+		return
+	}
+
+	vars := struct {
+		Level string `json:"level" valid:"Required"`
+	}{}
+
+	if err := server.ParseVars(req, &vars); err != nil {
+		send(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	switch vars.Level {
+	case "fatal", "error", "warn", "warning", "info", "debug":
+	default:
+		send(w, http.StatusBadRequest, map[string]string{"error": "invalid level " + vars.Level})
+		return
+	}
+
+	log.SetLevelByString(vars.Level)
+	log.Infof("%v set log level:%v", req.RemoteAddr, vars.Level)
+
+	send(w, http.StatusOK, map[string]string{"level": log.GetLogLevel().String()})
+}
+
+func (a *Admin) servePprof(w http.ResponseWriter, req *http.Request, path string) {
+	//pprof.Index根据/debug/pprof/前缀解析profile名.
+	r := req.Clone(req.Context())
+	r.URL.Path = path
+
+	switch strings.TrimPrefix(path, "/debug/pprof/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"dearcode.net/crab/log"
+)
+
+func TestAdminChecks(t *testing.T) {
+	ready := errors.New("db not ready")
+	a := New().
+		AddLiveness("self", func(context.Context) error { return nil }).
+		AddReadiness("db", func(context.Context) error { return ready }).
+		Info("version", "1.0.0")
+
+	ts := httptest.NewServer(a)
+	defer ts.Close()
+
+	cases := []struct {
+		path   string
+		status int
+		expect string
+	}{
+		{"/health", http.StatusOK, `"status":"ok"`},
+		{"/ready", http.StatusServiceUnavailable, `"db":"db not ready"`},
+		{"/info", http.StatusOK, `"version":"1.0.0"`},
+		{"/stats", http.StatusOK, `"goroutines"`},
+		{"/debug/pprof/", http.StatusNotFound, ""},
+	}
+
+	for _, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		buf, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%v expect status:%v, recv:%v", c.path, c.status, resp.StatusCode)
+		}
+		if !strings.Contains(string(buf), c.expect) {
+			t.Fatalf("%v expect:%v, recv:%v", c.path, c.expect, string(buf))
+		}
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer log.SetLevel(log.GetLogLevel())
+
+	a := New().EnablePprof()
+	if err := a.Mount("/admin_test/"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin_test/loglevel", strings.NewReader(url.Values{"level": {"warn"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+
+	result := map[string]string{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result["level"] != "warning" || log.GetLogLevel() != log.LogWarning {
+		t.Fatalf("expect level warning, recv:%v", result)
+	}
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin_test/loglevel?level=verbose", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect status:%v, recv:%v", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin_test/debug/pprof/cmdline", nil))
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("expect pprof cmdline, recv:%v", w.Code)
+	}
+}
+
+func TestAdminDefaultPrefix(t *testing.T) {
+	a := New()
+	if err := a.Mount(""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultPrefix+"/health", nil))
+	if a.prefix != DefaultPrefix || w.Code != http.StatusOK {
+		t.Fatalf("expect mount at %v, recv:%v, status:%v", DefaultPrefix, a.prefix, w.Code)
+	}
+}
@@ -90,7 +90,7 @@ func NameToPath(name string, depth int) string {
 	return string(buf[index:])
 }
 
-// Register 只要struct实现了Get(),Post(),Delete(),Put()接口就可以自动注册
+// Register 只要struct实现了Get(),Post(),Delete(),Put()接口就可以自动注册, 实现WS(*WSConn)可以注册websocket.
 func Register(obj interface{}) error {
 	return register(obj, "", false)
 }
@@ -166,6 +166,46 @@ func newHandlerRegexp(h handler) handlerRegexp {
 	return hr
 }
 
+// addPrefix 添加前缀匹配的handler, 调用方需持有server.mu.
+func addPrefix(method, path string, h handler) handlerRegexp {
+	p := prefix{
+		path: fmt.Sprintf("%v%v", method, path),
+	}
+
+	if idx := strings.Index(path, "{"); idx > 0 {
+		p.path = fmt.Sprintf("%v%v", method, path[:idx])
+	}
+
+	//	log.Debugf("path:%v", p.path)
+	if server.prefix.Has(&p) {
+		p = *(server.prefix.Get(&p).(*prefix))
+	}
+
+	exp := newHandlerRegexp(h)
+
+	p.exps = append(p.exps, exp)
+
+	server.prefix.ReplaceOrInsert(&p)
+
+	return exp
+}
+
+// RegisterPrefixHandler 注册自定义url前缀匹配, path中可以包含{key}形式的变量.
+func RegisterPrefixHandler(call func(http.ResponseWriter, *http.Request), method, path string) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	exp := addPrefix(method, path, handler{path: fmt.Sprintf("%v%v", method, path), call: call})
+
+	log.Infof("prefix handler %v %v %v", method, path, exp.keys)
+
+	return nil
+}
+
 func register(obj interface{}, path string, isPrefix bool) error {
 	rt := reflect.TypeOf(obj)
 	if rt.Kind() != reflect.Ptr {
@@ -184,6 +224,32 @@ func register(obj interface{}, path string, isPrefix bool) error {
 	defer server.mu.Unlock()
 
 	rv := reflect.ValueOf(obj)
+	ws, wsOpt := websocketMethod(rv)
+	hasGet := false
+
+	add := func(method string, call func(http.ResponseWriter, *http.Request)) error {
+		h := handler{
+			path: fmt.Sprintf("%v%v", method, path),
+			call: call,
+		}
+
+		//前缀匹配
+		if isPrefix {
+			exp := addPrefix(method, path, h)
+			log.Infof("prefix %v %v %v %v", method, path, exp.keys, rt)
+			return nil
+		}
+
+		//全路径匹配
+		if _, ok := server.path[h.path]; ok {
+			return errors.Errorf("exist url:%v %v", method, path)
+		}
+
+		server.path[h.path] = h
+		log.Infof("path %v %v %v", method, path, rt)
+		return nil
+	}
+
 	for i := 0; i < rv.NumMethod(); i++ {
 		method := rt.Method(i).Name
 		//log.Debugf("rt:%v, %d, method:%v", rt, i, method)
@@ -192,6 +258,8 @@ func register(obj interface{}, path string, isPrefix bool) error {
 		case http.MethodGet:
 		case http.MethodPut:
 		case http.MethodDelete:
+		case wsMethod, wsOptionMethod:
+			continue
 		default:
 			log.Warningf("ignore func:%v %v %v", method, path, rt)
 			continue
@@ -203,46 +271,47 @@ func register(obj interface{}, path string, isPrefix bool) error {
 			continue
 		}
 
-		h := handler{
-			path: fmt.Sprintf("%v%v", method, path),
-			call: mt.Interface().(func(http.ResponseWriter, *http.Request)),
-		}
-
-		//前缀匹配
-		if isPrefix {
-			p := prefix{
-				path: fmt.Sprintf("%v%v", method, path),
-			}
+		call := mt.Interface().(func(http.ResponseWriter, *http.Request))
 
-			if idx := strings.Index(path, "{"); idx > 0 {
-				p.path = fmt.Sprintf("%v%v", method, path[:idx])
-			}
+		//websocket与GET共用一个url, 根据请求头区分.
+		if method == http.MethodGet && ws != nil {
+			call = wsHandler(ws, wsOpt, call)
+			hasGet = true
+		}
 
-			//	log.Debugf("path:%v", p.path)
-			if server.prefix.Has(&p) {
-				p = *(server.prefix.Get(&p).(*prefix))
-			}
+		if err := add(method, call); err != nil {
+			return err
+		}
+	}
 
-			exp := newHandlerRegexp(h)
+	if ws != nil && !hasGet {
+		return add(http.MethodGet, wsHandler(ws, wsOpt, nil))
+	}
 
-			p.exps = append(p.exps, exp)
+	return nil
+}
 
-			server.prefix.ReplaceOrInsert(&p)
+// websocketMethod 查找struct的WS(*WSConn)及WSOption() *WSOption方法.
+func websocketMethod(rv reflect.Value) (func(*WSConn), *WSOption) {
+	mt := rv.MethodByName(wsMethod)
+	if !mt.IsValid() {
+		return nil, nil
+	}
 
-			log.Infof("prefix %v %v %v %v", method, path, exp.keys, rt)
-			continue
-		}
+	ws, ok := mt.Interface().(func(*WSConn))
+	if !ok {
+		log.Debugf("ignore func:%v %v", wsMethod, mt.Type())
+		return nil, nil
+	}
 
-		//全路径匹配
-		if _, ok := server.path[h.path]; ok {
-			return errors.Errorf("exist url:%v %v", method, path)
+	var opt *WSOption
+	if om := rv.MethodByName(wsOptionMethod); om.IsValid() {
+		if f, ok := om.Interface().(func() *WSOption); ok {
+			opt = f()
 		}
-
-		server.path[h.path] = h
-		log.Infof("path %v %v %v", method, path, rt)
 	}
 
-	return nil
+	return ws, opt
 }
 
 // AddFilter 添加过滤函数.
@@ -252,8 +321,7 @@ func AddFilter(filter Filter) {
 	server.filter = filter
 }
 
-func parseRequestValues(path string, ur handlerRegexp) context.Context {
-	ctx := context.Background()
+func parseRequestValues(ctx context.Context, path string, ur handlerRegexp) context.Context {
 	m := ur.exp.FindAllStringSubmatch(path, -1)
 	if len(m) == 0 {
 		return ctx
@@ -276,7 +344,12 @@ func RESTValue(req *http.Request, key string) (string, bool) {
 	return s, ok
 }
 
-func getHandler(method, path string) (func(http.ResponseWriter, *http.Request), context.Context) {
+// WithRESTValue 设置restful方式传递的值, 主要用于测试中直接调用handler.
+func WithRESTValue(req *http.Request, key, val string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userKey(key), val))
+}
+
+func getHandler(ctx context.Context, method, path string) (func(http.ResponseWriter, *http.Request), context.Context) {
 	server.mu.RLock()
 	defer server.mu.RUnlock()
 
@@ -308,7 +381,7 @@ func getHandler(method, path string) (func(http.ResponseWriter, *http.Request),
 				return ue.call, nil
 			}
 			//			log.Debugf("uri exp:%v, path:%v", ue, path)
-			return ue.call, parseRequestValues(path, ue)
+			return ue.call, parseRequestValues(ctx, path, ue)
 		}
 	}
 
@@ -331,7 +404,7 @@ func (s *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h, ctx := getHandler(r.Method, r.URL.Path)
+	h, ctx := getHandler(nr.Context(), r.Method, r.URL.Path)
 	if h == nil {
 		log.Errorf("%v %v %v not found.", r.RemoteAddr, r.Method, r.URL)
 		w.WriteHeader(http.StatusNotFound)
@@ -351,6 +424,11 @@ func defaultFilter(_ http.ResponseWriter, r *http.Request) *http.Request {
 	return r
 }
 
+// Handler 返回路由对象, 可用于httptest或者挂载到其它http.Server.
+func Handler() http.Handler {
+	return server
+}
+
 // Start 启动httpServer.
 func Start(addr string) (net.Listener, error) {
 	ln, err := net.Listen("tcp", addr)
@@ -0,0 +1,276 @@
+package servertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dearcode.net/crab/http/server"
+)
+
+// Request 测试请求构造器.
+type Request struct {
+	t      testing.TB
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	params map[string]string
+}
+
+// NewRequest 创建测试请求.
+func NewRequest(t testing.TB, method, path string) *Request {
+	return &Request{
+		t:      t,
+		method: method,
+		path:   path,
+		query:  make(url.Values),
+		header: make(http.Header),
+		params: make(map[string]string),
+	}
+}
+
+// Get 创建GET请求.
+func Get(t testing.TB, path string) *Request {
+	return NewRequest(t, http.MethodGet, path)
+}
+
+// Post 创建POST请求.
+func Post(t testing.TB, path string) *Request {
+	return NewRequest(t, http.MethodPost, path)
+}
+
+// Put 创建PUT请求.
+func Put(t testing.TB, path string) *Request {
+	return NewRequest(t, http.MethodPut, path)
+}
+
+// Delete 创建DELETE请求.
+func Delete(t testing.TB, path string) *Request {
+	return NewRequest(t, http.MethodDelete, path)
+}
+
+// Header 添加请求头.
+func (r *Request) Header(key, val string) *Request {
+	r.header.Add(key, val)
+	return r
+}
+
+// Query 添加url参数.
+func (r *Request) Query(key, val string) *Request {
+	r.query.Add(key, val)
+	return r
+}
+
+// Param 设置restful参数, 可以通过server.RESTValue获取.
+func (r *Request) Param(key, val string) *Request {
+	r.params[key] = val
+	return r
+}
+
+// Body 设置原始body及Content-Type.
+func (r *Request) Body(body []byte, contentType string) *Request {
+	r.body = body
+	if contentType != "" {
+		r.header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+// JSON 设置json格式的body.
+func (r *Request) JSON(v interface{}) *Request {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		r.t.Fatalf("marshal %#v error:%v", v, err)
+	}
+	return r.Body(buf, "application/json")
+}
+
+// Form 设置form表单格式的body.
+func (r *Request) Form(vals url.Values) *Request {
+	return r.Body([]byte(vals.Encode()), "application/x-www-form-urlencoded")
+}
+
+// build 生成http请求.
+func (r *Request) build() *http.Request {
+	u := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + r.query.Encode()
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req := httptest.NewRequest(r.method, u, body)
+	for k, vs := range r.header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	for k, v := range r.params {
+		req = server.WithRESTValue(req, k, v)
+	}
+
+	return req
+}
+
+// Do 通过server路由执行请求.
+func (r *Request) Do() *Result {
+	return r.Serve(server.Handler())
+}
+
+// Serve 使用指定的handler执行请求.
+func (r *Request) Serve(h http.Handler) *Result {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.build())
+	return &Result{t: r.t, Recorder: w}
+}
+
+// Call 不经过路由直接调用处理函数, 通过Param设置的参数会注入到请求中.
+func (r *Request) Call(h func(http.ResponseWriter, *http.Request)) *Result {
+	return r.Serve(http.HandlerFunc(h))
+}
+
+// Result 请求结果, 提供常用的断言.
+type Result struct {
+	t        testing.TB
+	Recorder *httptest.ResponseRecorder
+	resp     *server.Response
+	doc      interface{}
+}
+
+// Body 返回body内容.
+func (r *Result) Body() []byte {
+	return r.Recorder.Body.Bytes()
+}
+
+// Status 检查http状态码.
+func (r *Result) Status(code int) *Result {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.t.Fatalf("expect http status:%v, recv:%v, body:%s", code, r.Recorder.Code, r.Body())
+	}
+	return r
+}
+
+// Header 检查返回头.
+func (r *Result) Header(key, val string) *Result {
+	r.t.Helper()
+	if v := r.Recorder.Header().Get(key); v != val {
+		r.t.Fatalf("expect header %v:%v, recv:%v", key, val, v)
+	}
+	return r
+}
+
+// Contains 检查body中包含指定内容.
+func (r *Result) Contains(s string) *Result {
+	r.t.Helper()
+	if !bytes.Contains(r.Body(), []byte(s)) {
+		r.t.Fatalf("expect body contains:%v, recv:%s", s, r.Body())
+	}
+	return r
+}
+
+// Decode 解析json格式的body.
+func (r *Result) Decode(v interface{}) *Result {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body(), v); err != nil {
+		r.t.Fatalf("unmarshal %s error:%v", r.Body(), err)
+	}
+	return r
+}
+
+// Response 解析server.Response格式的返回结果.
+func (r *Result) Response() *server.Response {
+	r.t.Helper()
+	if r.resp == nil {
+		r.resp = &server.Response{}
+		r.Decode(r.resp)
+	}
+	return r.resp
+}
+
+// ResponseStatus 检查server.Response中的Status.
+func (r *Result) ResponseStatus(status int) *Result {
+	r.t.Helper()
+	if resp := r.Response(); resp.Status != status {
+		r.t.Fatalf("expect response status:%v, recv:%v, message:%v", status, resp.Status, resp.Message)
+	}
+	return r
+}
+
+// ResponseMessage 检查server.Response中的Message.
+func (r *Result) ResponseMessage(msg string) *Result {
+	r.t.Helper()
+	if resp := r.Response(); resp.Message != msg {
+		r.t.Fatalf("expect response message:%v, recv:%v", msg, resp.Message)
+	}
+	return r
+}
+
+// Field 检查json中指定字段的值, path以.分隔, 数组用下标, 如: Data.users.0.name.
+func (r *Result) Field(path string, expect interface{}) *Result {
+	r.t.Helper()
+
+	if r.doc == nil {
+		r.Decode(&r.doc)
+	}
+
+	val, ok := lookup(r.doc, path)
+	if !ok {
+		r.t.Fatalf("field %v not found in %s", path, r.Body())
+	}
+
+	//统一转换为json类型再比较, 如int与float64.
+	var ev interface{}
+	buf, _ := json.Marshal(expect)
+	json.Unmarshal(buf, &ev)
+
+	if !reflect.DeepEqual(val, ev) {
+		r.t.Fatalf("expect field %v:%#v, recv:%#v", path, ev, val)
+	}
+
+	return r
+}
+
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			val, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			doc = val
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
@@ -0,0 +1,76 @@
+package servertest
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"dearcode.net/crab/http/server"
+)
+
+type user struct {
+}
+
+func (u *user) GET(w http.ResponseWriter, req *http.Request) {
+	id, _ := server.RESTValue(req, "id")
+	server.SendResponseData(w, map[string]interface{}{
+		"id":    id,
+		"name":  req.URL.Query().Get("name"),
+		"roles": []string{"admin", "dev"},
+	})
+}
+
+func (u *user) POST(w http.ResponseWriter, req *http.Request) {
+	vars := struct {
+		Name string `json:"name" valid:"Required"`
+	}{}
+
+	if err := server.ParseVars(req, &vars); err != nil {
+		server.SendResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	server.SendResponse(w, 0, "hello %s", vars.Name)
+}
+
+var registerOnce sync.Once
+
+func register(t *testing.T) {
+	registerOnce.Do(func() {
+		if err := server.RegisterPrefix(&user{}, "/servertest/user/{id}"); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+}
+
+func TestRouter(t *testing.T) {
+	register(t)
+
+	Get(t, "/servertest/user/9527").Query("name", "crab").Do().
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		ResponseStatus(0).
+		Field("Data.id", "9527").
+		Field("Data.name", "crab").
+		Field("Data.roles.1", "dev")
+
+	Post(t, "/servertest/user/1").JSON(map[string]string{"name": "crab"}).Do().
+		ResponseMessage("hello crab")
+
+	Post(t, "/servertest/user/1").Form(url.Values{"name": {"form"}}).Do().
+		ResponseMessage("hello form")
+
+	Post(t, "/servertest/user/1").Do().
+		ResponseStatus(http.StatusBadRequest)
+
+	Delete(t, "/servertest/user/1").Do().
+		Status(http.StatusNotFound)
+}
+
+func TestCall(t *testing.T) {
+	Get(t, "/any/").Param("id", "42").Call((&user{}).GET).
+		Status(http.StatusOK).
+		Field("Data.id", "42").
+		Contains(`"roles":["admin","dev"]`)
+}
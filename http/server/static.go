@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/log"
+)
+
+// CacheRule 静态文件缓存规则, Pattern为path.Match格式，匹配文件名, 如: *.js, index.html.
+type CacheRule struct {
+	Pattern string
+	Value   string
+}
+
+// StaticOption 静态文件服务配置.
+type StaticOption struct {
+	//Index 访问目录时返回的文件, 默认index.html.
+	Index string
+	//SPA 文件不存在时返回Index文件，用于前端路由.
+	SPA bool
+	//CacheRules 按顺序匹配，第一个匹配的规则生效.
+	CacheRules []CacheRule
+	//DefaultCacheControl 没有规则匹配时使用的Cache-Control.
+	DefaultCacheControl string
+}
+
+type staticServer struct {
+	fsys   fs.FS
+	prefix string
+	opt    StaticOption
+	etags  sync.Map
+}
+
+// RegisterFS 在prefix下挂载fs.FS(包括embed.FS)提供静态文件服务, 支持ETag, Last-Modified, Range请求.
+// 访问不带/的prefix时跳转到prefix/.
+func RegisterFS(fsys fs.FS, prefix string, opt *StaticOption) error {
+	if fsys == nil {
+		return errors.New("fs is nil")
+	}
+
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	ss := &staticServer{fsys: fsys, prefix: prefix}
+	if opt != nil {
+		ss.opt = *opt
+	}
+
+	if ss.opt.Index == "" {
+		ss.opt.Index = "index.html"
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if err := RegisterPrefixHandler(ss.serve, method, prefix); err != nil {
+			return errors.Trace(err)
+		}
+
+		//跳转到目录, 保证index.html中的相对路径正确.
+		if bare := strings.TrimSuffix(prefix, "/"); bare != "" {
+			if err := RegisterHandler(redirectDir, method, bare); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// redirectDir 跳转到带/的目录地址, 保留url参数.
+func redirectDir(w http.ResponseWriter, req *http.Request) {
+	u := *req.URL
+	u.Path += "/"
+	http.Redirect(w, req, u.RequestURI(), http.StatusMovedPermanently)
+}
+
+// RegisterFSMust 挂载fs.FS提供静态文件服务, 如果遇到错误panic.
+func RegisterFSMust(fsys fs.FS, prefix string, opt *StaticOption) {
+	if err := RegisterFS(fsys, prefix, opt); err != nil {
+		panic(err.Error())
+	}
+}
+
+// cacheControl 根据文件名匹配缓存规则.
+func (ss *staticServer) cacheControl(name string) string {
+	base := path.Base(name)
+	for _, r := range ss.opt.CacheRules {
+		if ok, _ := path.Match(r.Pattern, base); ok {
+			return r.Value
+		}
+		if ok, _ := path.Match(r.Pattern, name); ok {
+			return r.Value
+		}
+	}
+	return ss.opt.DefaultCacheControl
+}
+
+// open 打开文件, 如果是目录返回目录下的Index文件.
+func (ss *staticServer) open(name string) (fs.File, fs.FileInfo, string, error) {
+	f, err := ss.fsys.Open(name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, "", err
+	}
+
+	if !fi.IsDir() {
+		return f, fi, name, nil
+	}
+
+	f.Close()
+
+	return ss.open(path.Join(name, ss.opt.Index))
+}
+
+// etag 有修改时间的文件用大小和修改时间生成, 否则(如embed.FS)用内容hash, 并缓存.
+func (ss *staticServer) etag(name string, fi fs.FileInfo, content []byte) string {
+	if !fi.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	if v, ok := ss.etags.Load(name); ok {
+		return v.(string)
+	}
+
+	sum := sha1.Sum(content)
+	tag := `"` + hex.EncodeToString(sum[:]) + `"`
+	ss.etags.Store(name, tag)
+
+	return tag
+}
+
+func (ss *staticServer) serve(w http.ResponseWriter, req *http.Request) {
+	upath := path.Clean(req.URL.Path)
+	if upath != strings.TrimSuffix(ss.prefix, "/") && !strings.HasPrefix(upath, ss.prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	fname := strings.TrimPrefix(strings.TrimPrefix(upath, ss.prefix), strings.TrimSuffix(ss.prefix, "/"))
+	if fname == "" {
+		fname = "."
+	}
+
+	if !fs.ValidPath(fname) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f, fi, name, err := ss.open(fname)
+	if err != nil && ss.opt.SPA && errors.Is(err, fs.ErrNotExist) {
+		f, fi, name, err = ss.open(ss.opt.Index)
+	}
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Errorf("open %v error:%v", fname, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	//有修改时间并且支持Seek的文件直接输出，不用全部读到内存中.
+	rs, seekable := f.(io.ReadSeeker)
+	if !seekable || fi.ModTime().IsZero() {
+		content, err := io.ReadAll(f)
+		if err != nil {
+			log.Errorf("read %v error:%v", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", ss.etag(name, fi, content))
+		rs = bytes.NewReader(content)
+	} else {
+		w.Header().Set("ETag", ss.etag(name, fi, nil))
+	}
+
+	if cc := ss.cacheControl(name); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+
+	http.ServeContent(w, req, path.Base(name), fi.ModTime(), rs)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<html>index</html>")},
+		"js/app.js":     {Data: []byte("console.log('app')"), ModTime: time.Now()},
+		"css/style.css": {Data: []byte("body{}")},
+	}
+
+	opt := &StaticOption{
+		SPA: true,
+		CacheRules: []CacheRule{
+			{Pattern: "index.html", Value: "no-cache"},
+			{Pattern: "*.js", Value: "public, max-age=31536000"},
+		},
+		DefaultCacheControl: "public, max-age=60",
+	}
+
+	if err := RegisterFS(fsys, "/static_test", opt); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := []struct {
+		path   string
+		status int
+		body   string
+		cache  string
+	}{
+		{"/static_test/", http.StatusOK, "<html>index</html>", "no-cache"},
+		{"/static_test/js/app.js", http.StatusOK, "console.log('app')", "public, max-age=31536000"},
+		{"/static_test/css/style.css", http.StatusOK, "body{}", "public, max-age=60"},
+		{"/static_test/user/1/detail", http.StatusOK, "<html>index</html>", "no-cache"},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.status {
+			t.Fatalf("%v expect status:%v, recv:%v", c.path, c.status, w.Code)
+		}
+		if w.Body.String() != c.body {
+			t.Fatalf("%v expect body:%v, recv:%v", c.path, c.body, w.Body.String())
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != c.cache {
+			t.Fatalf("%v expect cache-control:%v, recv:%v", c.path, c.cache, cc)
+		}
+		if w.Header().Get("ETag") == "" {
+			t.Fatalf("%v etag not found", c.path)
+		}
+	}
+
+	//不带/的prefix跳转到目录.
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static_test?v=1", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/static_test/?v=1" {
+		t.Fatalf("expect redirect to /static_test/?v=1, recv:%v %v", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestStaticFSConditional(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data.txt": {Data: []byte("0123456789"), ModTime: time.Now()},
+	}
+
+	if err := RegisterFS(fsys, "/static_cond/", nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static_cond/data.txt", nil))
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Last-Modified not found")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static_cond/data.txt", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expect status:%v, recv:%v", http.StatusNotModified, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/static_cond/data.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("expect range 2345, recv:%v %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static_cond/none.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect status:%v, recv:%v", http.StatusNotFound, w.Code)
+	}
+}
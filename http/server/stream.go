@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var (
+	//ErrStreamNotSupported ResponseWriter不支持Flush.
+	ErrStreamNotSupported = errors.New("streaming not supported")
+	//ErrStreamClosed 输出流已关闭.
+	ErrStreamClosed = errors.New("stream closed")
+	//ErrInvalidEvent 事件的ID或Event中有换行.
+	ErrInvalidEvent = errors.New("event id or name contains newline")
+
+	//newlineReplacer SSE中\r, \r\n也是换行.
+	newlineReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
+
+// Event Server-Sent Events事件, Data为string或[]byte时原样输出，其它类型json编码.
+type Event struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// EventStream Server-Sent Events输出流, 客户端断开后所有写操作返回错误.
+type EventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	lastID  string
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewEventStream 设置SSE响应头并创建输出流, handler返回前需要调用Close.
+func NewEventStream(w http.ResponseWriter, req *http.Request) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.Trace(ErrStreamNotSupported)
+	}
+
+	lastID := req.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		//部分EventSource polyfill通过url传递.
+		lastID = req.URL.Query().Get("lastEventId")
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &EventStream{
+		w:       w,
+		flusher: flusher,
+		ctx:     req.Context(),
+		lastID:  lastID,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// LastEventID 客户端重连时带上的最后一个事件ID, 用于断点续传.
+func (s *EventStream) LastEventID() string {
+	return s.lastID
+}
+
+// Done 客户端断开时关闭.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// write 加锁输出并flush.
+func (s *EventStream) write(buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	select {
+	case <-s.stop:
+		return errors.Trace(ErrStreamClosed)
+	default:
+	}
+
+	if _, err := s.w.Write(buf); err != nil {
+		return errors.Trace(err)
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// Send 发送一个事件, ID或Event中有换行时返回ErrInvalidEvent.
+func (s *EventStream) Send(e *Event) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return errors.Trace(ErrInvalidEvent)
+	}
+
+	bs := bytes.NewBuffer(nil)
+
+	if e.ID != "" {
+		fmt.Fprintf(bs, "id: %s\n", e.ID)
+	}
+
+	if e.Event != "" {
+		fmt.Fprintf(bs, "event: %s\n", e.Event)
+	}
+
+	if e.Retry > 0 {
+		fmt.Fprintf(bs, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		data = string(buf)
+	}
+
+	//多行数据每行都要加data前缀.
+	for _, line := range strings.Split(newlineReplacer.Replace(data), "\n") {
+		fmt.Fprintf(bs, "data: %s\n", line)
+	}
+
+	bs.WriteString("\n")
+
+	return s.write(bs.Bytes())
+}
+
+// Retry 设置客户端断线重连间隔.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// Heartbeat 定时发送注释行保持连接, 直到客户端断开或Close, interval不大于0时忽略.
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.stop:
+				return
+			case <-t.C:
+				if err := s.write([]byte(": ping\n\n")); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close 停止心跳, handler返回后ResponseWriter不能再使用.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// JSONLines 分块输出json lines(每行一个json对象), 用于返回大结果集.
+type JSONLines struct {
+	w          *bufio.Writer
+	flusher    http.Flusher
+	ctx        context.Context
+	enc        *json.Encoder
+	count      int
+	flushEvery int
+}
+
+const (
+	defaultFlushEvery = 100
+)
+
+// NewJSONLines 设置响应头并创建json lines输出流, 默认每100行flush一次.
+func NewJSONLines(w http.ResponseWriter, req *http.Request) *JSONLines {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	bw := bufio.NewWriter(w)
+	jl := &JSONLines{
+		w:          bw,
+		ctx:        req.Context(),
+		enc:        json.NewEncoder(bw),
+		flushEvery: defaultFlushEvery,
+	}
+	jl.flusher, _ = w.(http.Flusher)
+
+	return jl
+}
+
+// FlushEvery 设置每输出n行flush一次.
+func (j *JSONLines) FlushEvery(n int) *JSONLines {
+	if n > 0 {
+		j.flushEvery = n
+	}
+	return j
+}
+
+// Write 输出一行, 客户端断开返回错误.
+func (j *JSONLines) Write(v interface{}) error {
+	if err := j.ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := j.enc.Encode(v); err != nil {
+		return errors.Trace(err)
+	}
+
+	if j.count++; j.count%j.flushEvery == 0 {
+		return j.Flush()
+	}
+
+	return nil
+}
+
+// WriteSlice 把切片中每个元素输出为一行, 如orm.Stmt.Query查询出的结果.
+func (j *JSONLines) WriteSlice(slice interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(slice))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return errors.Errorf("need slice, recv:%v", rv.Kind())
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := j.Write(rv.Index(i).Interface()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return j.Flush()
+}
+
+// Flush 输出缓存中的数据.
+func (j *JSONLines) Flush() error {
+	if err := j.w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if j.flusher != nil {
+		j.flusher.Flush()
+	}
+
+	return nil
+}
+
+// SendJSONLines 以json lines格式分块返回切片数据.
+func SendJSONLines(w http.ResponseWriter, req *http.Request, slice interface{}) error {
+	return NewJSONLines(w, req).WriteSlice(slice)
+}
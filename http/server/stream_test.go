@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func TestEventStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		es, err := NewEventStream(w, req)
+		if err != nil {
+			t.Errorf("NewEventStream error:%v", err)
+			return
+		}
+		defer es.Close()
+
+		es.Heartbeat(10 * time.Millisecond)
+
+		if es.LastEventID() != "2" {
+			t.Errorf("expect last event id:2, recv:%v", es.LastEventID())
+		}
+
+		es.Send(&Event{ID: "3", Event: "progress", Data: map[string]int{"done": 3}})
+		time.Sleep(30 * time.Millisecond)
+		es.Send(&Event{ID: "4", Data: "line1\r\nline2\rline3"})
+
+		if err := es.Send(&Event{ID: "5\nevent: fake", Data: "x"}); errors.Cause(err) != ErrInvalidEvent {
+			t.Errorf("expect ErrInvalidEvent, recv:%v", err)
+		}
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Last-Event-ID", "2")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expect content-type:text/event-stream, recv:%v", ct)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	body := strings.Join(lines, "\n")
+	for _, expect := range []string{
+		"id: 3\nevent: progress\ndata: {\"done\":3}\n",
+		": ping\n",
+		"id: 4\ndata: line1\ndata: line2\ndata: line3\n",
+	} {
+		if !strings.Contains(body, expect) {
+			t.Fatalf("expect:%q, recv:%q", expect, body)
+		}
+	}
+}
+
+func TestEventStreamHeartbeatInvalid(t *testing.T) {
+	w := httptest.NewRecorder()
+	es, err := NewEventStream(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//不大于0的间隔不启动心跳.
+	es.Heartbeat(0)
+	es.Heartbeat(-time.Second)
+	es.Close()
+
+	if strings.Contains(w.Body.String(), ": ping") {
+		t.Fatalf("expect no heartbeat, recv:%q", w.Body.String())
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	rows := []struct {
+		ID   int
+		Name string
+	}{{1, "a"}, {2, "b"}, {3, "c"}}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := NewJSONLines(w, req).FlushEvery(2).WriteSlice(rows); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expect := "{\"ID\":1,\"Name\":\"a\"}\n{\"ID\":2,\"Name\":\"b\"}\n{\"ID\":3,\"Name\":\"c\"}\n"
+	if w.Body.String() != expect {
+		t.Fatalf("expect:%q, recv:%q", expect, w.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := SendJSONLines(httptest.NewRecorder(), req.WithContext(ctx), rows); err == nil {
+		t.Fatalf("expect error after client disconnect")
+	}
+}
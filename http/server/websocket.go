@@ -0,0 +1,600 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/log"
+)
+
+// websocket消息类型.
+const (
+	//TextMessage 文本消息.
+	TextMessage = 1
+	//BinaryMessage 二进制消息.
+	BinaryMessage = 2
+	//CloseMessage 关闭连接.
+	CloseMessage = 8
+	//PingMessage ping.
+	PingMessage = 9
+	//PongMessage pong.
+	PongMessage = 10
+)
+
+// websocket关闭状态码.
+const (
+	//CloseNormal 正常关闭.
+	CloseNormal = 1000
+	//CloseGoingAway 服务端或客户端退出.
+	CloseGoingAway = 1001
+	//CloseProtocolError 协议错误.
+	CloseProtocolError = 1002
+	//CloseInvalidPayload 消息内容错误, 如文本消息不是utf8.
+	CloseInvalidPayload = 1007
+	//CloseMessageTooBig 消息超过大小限制.
+	CloseMessageTooBig = 1009
+)
+
+const (
+	wsGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMethod         = "WS"
+	wsOptionMethod   = "WSOption"
+	continuationCode = 0
+	maxControlSize   = 125
+)
+
+var (
+	//ErrNotWebSocket 请求不是websocket升级请求.
+	ErrNotWebSocket = errors.New("not websocket upgrade request")
+	//ErrBadOrigin Origin检查失败.
+	ErrBadOrigin = errors.New("websocket origin not allowed")
+)
+
+// WSOption websocket连接配置, 注册的struct可以实现WSOption() *WSOption方法自定义.
+type WSOption struct {
+	//MaxMessageSize 单个消息最大长度, 默认4M.
+	MaxMessageSize int64
+	//PingInterval 发送ping的间隔, 默认30秒.
+	PingInterval time.Duration
+	//PongWait 多长时间没有收到客户端数据断开连接, 默认60秒.
+	PongWait time.Duration
+	//WriteTimeout 写超时, 默认10秒.
+	WriteTimeout time.Duration
+	//CheckOrigin 检查Origin, 默认只允许同源请求.
+	CheckOrigin func(*http.Request) bool
+}
+
+// WSCloseError 对端关闭连接.
+type WSCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *WSCloseError) Error() string {
+	return fmt.Sprintf("websocket closed %d %s", e.Code, e.Text)
+}
+
+// WSConn websocket连接.
+type WSConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	req       *http.Request
+	opt       WSOption
+	isServer  bool
+	closeSent bool
+	done      chan struct{}
+	closeOnce sync.Once
+	wmu       sync.Mutex
+}
+
+func defaultWSOption(opt *WSOption) WSOption {
+	o := WSOption{}
+	if opt != nil {
+		o = *opt
+	}
+
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = 4 << 20
+	}
+
+	if o.PingInterval <= 0 {
+		o.PingInterval = 30 * time.Second
+	}
+
+	if o.PongWait <= 0 {
+		o.PongWait = 60 * time.Second
+	}
+
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+
+	if o.CheckOrigin == nil {
+		o.CheckOrigin = sameOrigin
+	}
+
+	return o
+}
+
+// sameOrigin 没有Origin或者Origin与Host相同.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+func headerContains(h http.Header, key, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(key)] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWebSocket 是否为websocket升级请求.
+func IsWebSocket(req *http.Request) bool {
+	return req.Method == http.MethodGet &&
+		headerContains(req.Header, "Connection", "upgrade") &&
+		headerContains(req.Header, "Upgrade", "websocket")
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Upgrade 把http连接升级为websocket连接, 失败时已经返回了对应的http状态码.
+func Upgrade(w http.ResponseWriter, req *http.Request, opt *WSOption) (*WSConn, error) {
+	o := defaultWSOption(opt)
+
+	fail := func(code int, err error) (*WSConn, error) {
+		http.Error(w, http.StatusText(code), code)
+		return nil, err
+	}
+
+	if !IsWebSocket(req) {
+		return fail(http.StatusBadRequest, errors.Trace(ErrNotWebSocket))
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, errors.Errorf("unsupported websocket version:%v", req.Header.Get("Sec-WebSocket-Version")))
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return fail(http.StatusBadRequest, errors.New("Sec-WebSocket-Key not found"))
+	}
+
+	if !o.CheckOrigin(req) {
+		return fail(http.StatusForbidden, errors.Trace(ErrBadOrigin))
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fail(http.StatusInternalServerError, errors.New("response not support hijack"))
+	}
+
+	//hijack之后不能再通过w返回状态码.
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+
+	conn.SetWriteDeadline(time.Now().Add(o.WriteTimeout))
+	if _, err = conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+
+	wc := newWSConn(conn, brw.Reader, o, true)
+	wc.req = req
+
+	go wc.keepalive()
+
+	return wc, nil
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, opt WSOption, isServer bool) *WSConn {
+	return &WSConn{
+		conn:     conn,
+		br:       br,
+		opt:      opt,
+		isServer: isServer,
+		done:     make(chan struct{}),
+	}
+}
+
+// Request 升级前的http请求.
+func (c *WSConn) Request() *http.Request {
+	return c.req
+}
+
+// RemoteAddr 客户端地址.
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// keepalive 定时发送ping.
+func (c *WSConn) keepalive() {
+	t := time.NewTicker(c.opt.PingInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.writeFrame(PingMessage, nil); err != nil {
+				log.Debugf("%v ping error:%v", c.conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+// writeFrame 输出一个完整帧, 客户端需要mask.
+func (c *WSConn) writeFrame(opcode int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closeSent {
+		return errors.Trace(&WSCloseError{Code: CloseNormal, Text: "close sent"})
+	}
+
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, len(payload)+14)
+	buf = append(buf, 0x80|byte(opcode))
+
+	var mb byte
+	if !c.isServer {
+		mb = 0x80
+	}
+
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, mb|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, mb|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, mb|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var key [4]byte
+		rand.Read(key[:])
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.opt.WriteTimeout))
+	_, err := c.conn.Write(buf)
+	return errors.Trace(err)
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// readFrame 读取一帧.
+func (c *WSConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.opt.PongWait))
+
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+
+	fin = h[0]&0x80 != 0
+	opcode = int(h[0] & 0x0f)
+	if h[0]&0x70 != 0 {
+		err = &WSCloseError{Code: CloseProtocolError, Text: "reserved bits set"}
+		return
+	}
+
+	masked := h[1]&0x80 != 0
+	if masked != c.isServer {
+		err = &WSCloseError{Code: CloseProtocolError, Text: "bad mask"}
+		return
+	}
+
+	n := int64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]))
+	}
+
+	if opcode >= CloseMessage && (n > maxControlSize || !fin) {
+		err = &WSCloseError{Code: CloseProtocolError, Text: "bad control frame"}
+		return
+	}
+
+	if n < 0 || n > c.opt.MaxMessageSize {
+		err = &WSCloseError{Code: CloseMessageTooBig, Text: "message too big"}
+		return
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, key[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+
+	if masked {
+		maskBytes(key, payload)
+	}
+
+	return
+}
+
+// ReadMessage 读取一个完整消息, 自动处理ping, pong及分片, 对端关闭时返回*WSCloseError.
+func (c *WSConn) ReadMessage() (int, []byte, error) {
+	var msgType int
+	var data []byte
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			if ce, ok := err.(*WSCloseError); ok {
+				c.writeClose(ce.Code, ce.Text)
+			}
+			return 0, nil, errors.Trace(err)
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = c.writeFrame(PongMessage, payload); err != nil {
+				return 0, nil, errors.Trace(err)
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			if len(payload) == 1 {
+				c.writeClose(CloseProtocolError, "bad close payload")
+				return 0, nil, errors.Trace(&WSCloseError{Code: CloseProtocolError, Text: "bad close payload"})
+			}
+			ce := &WSCloseError{Code: CloseNormal}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Text = string(payload[2:])
+			}
+			c.writeClose(ce.Code, "")
+			return 0, nil, errors.Trace(ce)
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				c.writeClose(CloseProtocolError, "unexpected data frame")
+				return 0, nil, errors.Trace(&WSCloseError{Code: CloseProtocolError, Text: "unexpected data frame"})
+			}
+			msgType = opcode
+		case continuationCode:
+			if msgType == 0 {
+				c.writeClose(CloseProtocolError, "unexpected continuation")
+				return 0, nil, errors.Trace(&WSCloseError{Code: CloseProtocolError, Text: "unexpected continuation"})
+			}
+		default:
+			c.writeClose(CloseProtocolError, "unknown opcode")
+			return 0, nil, errors.Trace(&WSCloseError{Code: CloseProtocolError, Text: "unknown opcode"})
+		}
+
+		if int64(len(data)+len(payload)) > c.opt.MaxMessageSize {
+			c.writeClose(CloseMessageTooBig, "message too big")
+			return 0, nil, errors.Trace(&WSCloseError{Code: CloseMessageTooBig, Text: "message too big"})
+		}
+
+		data = append(data, payload...)
+
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(data) {
+				c.writeClose(CloseInvalidPayload, "invalid utf8")
+				return 0, nil, errors.Trace(&WSCloseError{Code: CloseInvalidPayload, Text: "invalid utf8"})
+			}
+			return msgType, data, nil
+		}
+	}
+}
+
+// WriteMessage 发送消息, 可并发调用.
+func (c *WSConn) WriteMessage(msgType int, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return errors.Errorf("invalid message type:%v", msgType)
+	}
+	return c.writeFrame(msgType, data)
+}
+
+// ReadJSON 读取消息并解析json.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(json.Unmarshal(data, v))
+}
+
+// WriteJSON 以文本消息发送json.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return c.writeFrame(TextMessage, buf)
+}
+
+func (c *WSConn) writeClose(code int, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, text...)
+	if len(payload) > maxControlSize {
+		payload = payload[:maxControlSize]
+	}
+	return c.writeFrame(CloseMessage, payload)
+}
+
+// Close 发送关闭消息并关闭连接.
+func (c *WSConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.writeClose(CloseNormal, "")
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return errors.Trace(err)
+}
+
+// wsHandler 根据请求类型调用websocket或普通GET处理函数.
+func wsHandler(ws func(*WSConn), opt *WSOption, get func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !IsWebSocket(req) {
+			if get != nil {
+				get(w, req)
+				return
+			}
+			SendResponse(w, http.StatusBadRequest, "websocket upgrade required")
+			return
+		}
+
+		conn, err := Upgrade(w, req, opt)
+		if err != nil {
+			log.Errorf("%v upgrade error:%v", req.RemoteAddr, err)
+			return
+		}
+		defer conn.Close()
+
+		ws(conn)
+	}
+}
+
+// WSHub 管理一组websocket连接, 用于广播.
+type WSHub struct {
+	conns map[*WSConn]struct{}
+	mu    sync.RWMutex
+}
+
+// NewWSHub 创建广播组.
+func NewWSHub() *WSHub {
+	return &WSHub{conns: make(map[*WSConn]struct{})}
+}
+
+// Add 添加连接.
+func (h *WSHub) Add(c *WSConn) {
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+// Remove 删除连接.
+func (h *WSHub) Remove(c *WSConn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+}
+
+// Len 连接数.
+func (h *WSHub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Broadcast 并发向所有连接发送消息, 发送失败的连接会被关闭并移除, 返回成功发送的数量.
+// 每个连接的写入受WriteTimeout限制, 慢连接不会阻塞其它连接.
+func (h *WSHub) Broadcast(msgType int, data []byte) int {
+	h.mu.RLock()
+	conns := make([]*WSConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	var n int32
+	var wg sync.WaitGroup
+
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *WSConn) {
+			defer wg.Done()
+			if err := c.WriteMessage(msgType, data); err != nil {
+				log.Debugf("%v broadcast error:%v", c.RemoteAddr(), err)
+				h.Remove(c)
+				c.Close()
+				return
+			}
+			atomic.AddInt32(&n, 1)
+		}(c)
+	}
+
+	wg.Wait()
+
+	return int(n)
+}
+
+// BroadcastJSON 以json格式广播.
+func (h *WSHub) BroadcastJSON(v interface{}) (int, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return h.Broadcast(TextMessage, buf), nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type wsEcho struct {
+	hub *WSHub
+}
+
+var (
+	echo       = &wsEcho{hub: NewWSHub()}
+	wsEchoOnce sync.Once
+)
+
+func (e *wsEcho) GET(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("plain get"))
+}
+
+func (e *wsEcho) WS(conn *WSConn) {
+	e.hub.Add(conn)
+	defer e.hub.Remove(conn)
+
+	for {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(data) == "broadcast" {
+			e.hub.Broadcast(mt, data)
+			continue
+		}
+		conn.WriteMessage(mt, data)
+	}
+}
+
+func (e *wsEcho) WSOption() *WSOption {
+	return &WSOption{MaxMessageSize: 16, PingInterval: time.Second}
+}
+
+// dialWS 测试用客户端.
+func dialWS(t *testing.T, addr, path string) *WSConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr, key)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect status:101, recv:%v", resp.StatusCode)
+	}
+
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+		t.Fatalf("expect accept:%v, recv:%v", acceptKey(key), accept)
+	}
+
+	return newWSConn(conn, br, defaultWSOption(nil), false)
+}
+
+func TestWebSocket(t *testing.T) {
+	wsEchoOnce.Do(func() {
+		if err := RegisterPath(echo, "/ws_test/"); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ws_test/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "plain get" {
+		t.Fatalf("expect plain get, recv:%s", body)
+	}
+
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	c1 := dialWS(t, addr, "/ws_test/")
+	defer c1.Close()
+	c2 := dialWS(t, addr, "/ws_test/")
+	defer c2.Close()
+
+	if err = c1.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	mt, data, err := c1.ReadMessage()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if mt != TextMessage || string(data) != "hello" {
+		t.Fatalf("expect hello, recv:%v %s", mt, data)
+	}
+
+	//等待c2加入hub.
+	c2.WriteMessage(TextMessage, []byte("ping"))
+	c2.ReadMessage()
+
+	if err = c1.WriteMessage(TextMessage, []byte("broadcast")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, c := range []*WSConn{c1, c2} {
+		if _, data, err = c.ReadMessage(); err != nil || string(data) != "broadcast" {
+			t.Fatalf("expect broadcast, recv:%s, err:%v", data, err)
+		}
+	}
+
+	//超过大小限制.
+	if err = c1.WriteMessage(BinaryMessage, make([]byte, 32)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, _, err = c1.ReadMessage()
+	ce, ok := errors.Cause(err).(*WSCloseError)
+	if !ok || ce.Code != CloseMessageTooBig {
+		t.Fatalf("expect close %v, recv:%v", CloseMessageTooBig, err)
+	}
+}
+
+func TestWebSocketBadFrame(t *testing.T) {
+	wsEchoOnce.Do(func() {
+		if err := RegisterPath(echo, "/ws_test/"); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws_test/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "MDEyMzQ1Njc4OWFiY2RlZg==")
+	req.Header.Set("Origin", "http://other.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect status:403, recv:%v", resp.StatusCode)
+	}
+
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	cases := []struct {
+		opcode  int
+		payload []byte
+		code    int
+	}{
+		{TextMessage, []byte{0xff, 0xfe}, CloseInvalidPayload},
+		{CloseMessage, []byte{1}, CloseProtocolError},
+	}
+
+	for _, c := range cases {
+		conn := dialWS(t, addr, "/ws_test/")
+		if err = conn.writeFrame(c.opcode, c.payload); err != nil {
+			t.Fatal(err.Error())
+		}
+		//客户端已经发送了close, 只读取服务端返回的close帧.
+		_, opcode, payload, err := conn.readFrame()
+		if err != nil || opcode != CloseMessage || len(payload) < 2 {
+			t.Fatalf("expect close frame, recv:%v %v, err:%v", opcode, payload, err)
+		}
+		if code := int(payload[0])<<8 | int(payload[1]); code != c.code {
+			t.Fatalf("expect close %v, recv:%v", c.code, code)
+		}
+		conn.Close()
+	}
+}
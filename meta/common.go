@@ -13,4 +13,6 @@ var (
 	ErrFieldNotFound = errors.New("struct's field not found")
 	//ErrArgIsNil argument is nil.
 	ErrArgIsNil = errors.New("argument is nil")
+	//ErrNoCondition update or delete without condition.
+	ErrNoCondition = errors.New("no condition")
 )
@@ -0,0 +1,207 @@
+package orm
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Cond 查询条件, 值都通过参数绑定, 列名由调用方保证安全, 不要使用用户输入.
+type Cond struct {
+	sql  string
+	args []interface{}
+}
+
+// SQL 返回条件语句及绑定参数.
+func (c Cond) SQL() (string, []interface{}) {
+	return c.sql, c.args
+}
+
+// Expr 自定义条件, sql中使用?作为占位符, 空切片展开为null, in及not in都不匹配任何行.
+func Expr(sql string, args ...interface{}) Cond {
+	s, a := expandArgs(sql, args)
+	return Cond{sql: s, args: a}
+}
+
+func compare(col, op string, val interface{}) Cond {
+	return Cond{sql: col + " " + op + " ?", args: []interface{}{val}}
+}
+
+// Eq col = val.
+func Eq(col string, val interface{}) Cond {
+	return compare(col, "=", val)
+}
+
+// Ne col <> val.
+func Ne(col string, val interface{}) Cond {
+	return compare(col, "<>", val)
+}
+
+// Gt col > val.
+func Gt(col string, val interface{}) Cond {
+	return compare(col, ">", val)
+}
+
+// Ge col >= val.
+func Ge(col string, val interface{}) Cond {
+	return compare(col, ">=", val)
+}
+
+// Lt col < val.
+func Lt(col string, val interface{}) Cond {
+	return compare(col, "<", val)
+}
+
+// Le col <= val.
+func Le(col string, val interface{}) Cond {
+	return compare(col, "<=", val)
+}
+
+// Like col like val, val中的%,_由调用方添加.
+func Like(col string, val interface{}) Cond {
+	return compare(col, "like", val)
+}
+
+// In col in (vals), vals可以是多个值或一个切片, 为空时条件为假.
+func In(col string, vals ...interface{}) Cond {
+	if len(vals) == 1 {
+		if vs, ok := sliceArgs(vals[0]); ok {
+			vals = vs
+		}
+	}
+
+	if len(vals) == 0 {
+		return Cond{sql: "1 = 0"}
+	}
+
+	return Cond{sql: col + " in (" + placeholders(len(vals)) + ")", args: vals}
+}
+
+// NotIn col not in (vals), vals可以是多个值或一个切片, 为空时条件为真.
+func NotIn(col string, vals ...interface{}) Cond {
+	if len(vals) == 1 {
+		if vs, ok := sliceArgs(vals[0]); ok {
+			vals = vs
+		}
+	}
+
+	if len(vals) == 0 {
+		return Cond{sql: "1 = 1"}
+	}
+
+	return Cond{sql: col + " not in (" + placeholders(len(vals)) + ")", args: vals}
+}
+
+// Between col between min and max.
+func Between(col string, min, max interface{}) Cond {
+	return Cond{sql: col + " between ? and ?", args: []interface{}{min, max}}
+}
+
+// IsNull col is null.
+func IsNull(col string) Cond {
+	return Cond{sql: col + " is null"}
+}
+
+// NotNull col is not null.
+func NotNull(col string) Cond {
+	return Cond{sql: col + " is not null"}
+}
+
+func join(op string, conds []Cond) Cond {
+	var parts []string
+	var args []interface{}
+	for _, c := range conds {
+		if c.sql == "" {
+			continue
+		}
+		parts = append(parts, "("+c.sql+")")
+		args = append(args, c.args...)
+	}
+
+	if len(parts) == 1 {
+		return Cond{sql: strings.TrimSuffix(strings.TrimPrefix(parts[0], "("), ")"), args: args}
+	}
+
+	return Cond{sql: strings.Join(parts, " "+op+" "), args: args}
+}
+
+// And 条件都满足, 忽略空条件.
+func And(conds ...Cond) Cond {
+	return join("and", conds)
+}
+
+// Or 满足任一条件, 忽略空条件.
+func Or(conds ...Cond) Cond {
+	return join("or", conds)
+}
+
+// Not 条件取反.
+func Not(c Cond) Cond {
+	return Cond{sql: "not (" + c.sql + ")", args: c.args}
+}
+
+// sprintf 兼容旧的格式化条件, 参数以切片传入, 避免vet把Where, Raw当作printf检查.
+func sprintf(f string, args []interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sliceArgs 切片参数展开, []byte及实现了driver.Valuer的不展开.
+func sliceArgs(arg interface{}) ([]interface{}, bool) {
+	if _, ok := arg.(driver.Valuer); ok {
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(arg)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	vals := make([]interface{}, rv.Len())
+	for i := range vals {
+		vals[i] = rv.Index(i).Interface()
+	}
+	return vals, true
+}
+
+// expandArgs 把切片参数对应的?展开为多个?, 忽略引号中的?.
+func expandArgs(query string, args []interface{}) (string, []interface{}) {
+	var bs bytes.Buffer
+	var result []interface{}
+	var quote byte
+	idx := 0
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?' && idx < len(args):
+			if vs, ok := sliceArgs(args[idx]); ok {
+				idx++
+				if len(vs) == 0 {
+					//空列表, in (null)及not in (null)结果都为空, not in空列表使用NotIn.
+					bs.WriteString("null")
+					continue
+				}
+				bs.WriteString(placeholders(len(vs)))
+				result = append(result, vs...)
+				continue
+			}
+			result = append(result, args[idx])
+			idx++
+		}
+		bs.WriteByte(ch)
+	}
+
+	return bs.String(), append(result, args[idx:]...)
+}
@@ -0,0 +1,52 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCond(t *testing.T) {
+	c := And(
+		Eq("name", "a' or 1=1 --"),
+		Or(In("id", []int64{1, 2, 3}), Between("age", 10, 20), IsNull("deleted")),
+		Like("email", "%@crab%"),
+		And(),
+	)
+
+	expect := "(name = ?) and ((id in (?, ?, ?)) or (age between ? and ?) or (deleted is null)) and (email like ?)"
+	sql, args := c.SQL()
+	if sql != expect {
+		t.Fatalf("expect:%s\n recv:%s", expect, sql)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{"a' or 1=1 --", int64(1), int64(2), int64(3), 10, 20, "%@crab%"}) {
+		t.Fatalf("unexpected args:%#v", args)
+	}
+
+	if sql, args = In("id").SQL(); sql != "1 = 0" || len(args) != 0 {
+		t.Fatalf("expect false cond, recv:%v, %v", sql, args)
+	}
+
+	if sql, args = NotIn("id", []int{}).SQL(); sql != "1 = 1" || len(args) != 0 {
+		t.Fatalf("expect true cond, recv:%v, %v", sql, args)
+	}
+
+	if sql, args = NotIn("id", 1, 2).SQL(); sql != "id not in (?, ?)" || len(args) != 2 {
+		t.Fatalf("unexpected not in:%v, %v", sql, args)
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	sql, args := expandArgs("name = '?' and id in (?) and type = ? and data = ?", []interface{}{[]int{1, 2}, 3, []byte("raw")})
+	if sql != "name = '?' and id in (?, ?) and type = ? and data = ?" {
+		t.Fatalf("unexpected sql:%v", sql)
+	}
+	if len(args) != 4 || args[0] != 1 || args[2] != 3 {
+		t.Fatalf("unexpected args:%#v", args)
+	}
+
+	//空切片展开为null.
+	if sql, args = expandArgs("id not in (?)", []interface{}{[]int{}}); sql != "id not in (null)" || len(args) != 0 {
+		t.Fatalf("unexpected empty slice:%v, %v", sql, args)
+	}
+}
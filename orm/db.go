@@ -1,17 +1,19 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
-	//mysql
-	_ "github.com/go-sql-driver/mysql"
 )
 
 // DB db instance.
 type DB struct {
+	//Driver 驱动名, 为空时使用mysql, 驱动需要调用方导入, mysql可导入dearcode.net/crab/orm/mysql.
+	Driver   string
 	IP       string
 	Port     int
 	DBName   string
@@ -19,6 +21,10 @@ type DB struct {
 	Passwd   string
 	Charset  string
 	Timeout  int
+	//StmtTimeout NewStmt创建的Stmt默认的sql超时时间, 0不限制.
+	StmtTimeout time.Duration
+	//ConsecutiveIDs mysql的BatchInsert使用多行insert, 见MySQL.ConsecutiveIDs.
+	ConsecutiveIDs bool
 }
 
 // NewDB create db instance, timeout 单位:秒.
@@ -34,10 +40,40 @@ func NewDB(ip string, port int, dbName, user, pass, charset string, timeout int)
 	}
 }
 
+// Dialect 返回驱动对应的Dialect, 不支持的驱动返回MySQL.
+func (db *DB) Dialect() Dialect {
+	d, err := GetDialect(db.Driver)
+	if err != nil {
+		d = MySQL{}
+	}
+
+	if m, ok := d.(MySQL); ok {
+		m.ConsecutiveIDs = db.ConsecutiveIDs
+		return m
+	}
+	return d
+}
+
+// NewStmt 使用db的Dialect及StmtTimeout创建Stmt.
+func (db *DB) NewStmt(conn Executor, table string) *Stmt {
+	return NewStmt(conn, table).SetDialect(db.Dialect()).Timeout(db.StmtTimeout)
+}
+
 // GetConnection open new connect to db.
 func (db *DB) GetConnection() (*sql.DB, error) {
-	dsn := db.getDSN()
-	stmtDB, err := sql.Open("mysql", dsn)
+	d, err := GetDialect(db.Driver)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if !driverRegistered(d.Name()) {
+		if d.Name() == DriverMySQL {
+			return nil, errors.Errorf("sql driver %q not registered, import _ \"dearcode.net/crab/orm/mysql\"", d.Name())
+		}
+		return nil, errors.Errorf("sql driver %q not registered", d.Name())
+	}
+
+	stmtDB, err := sql.Open(d.Name(), d.DSN(db))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -50,18 +86,22 @@ func (db *DB) GetConnection() (*sql.DB, error) {
 	return stmtDB, nil
 }
 
+// driverRegistered 驱动是否已通过sql.Register注册.
+func driverRegistered(name string) bool {
+	for _, n := range sql.Drivers() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	maxAllowedPacket = 134217728
 )
 
 func (db *DB) getDSN() string {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", db.UserName, db.Passwd, db.IP, db.Port, db.DBName)
-
-	if optStr := db.getOpt(); optStr != "" {
-		dsn = fmt.Sprintf("%s?%s", dsn, optStr)
-	}
-
-	return dsn
+	return db.Dialect().DSN(db)
 }
 
 func (db *DB) getOpt() string {
@@ -79,3 +119,10 @@ func (db *DB) getOpt() string {
 
 	return strings.Join(opts, "&")
 }
+
+// PingCheck 返回检查数据库连接的函数, 可用于admin的就绪检查.
+func PingCheck(db *sql.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return errors.Trace(db.PingContext(ctx))
+	}
+}
@@ -0,0 +1,342 @@
+package orm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Dialect 不同数据库的sql差异.
+type Dialect interface {
+	//Name 驱动名, 用于sql.Open.
+	Name() string
+	//DSN 生成连接串.
+	DSN(db *DB) string
+	//Rebind 把?占位符转换为数据库支持的格式.
+	Rebind(query string) string
+	//Quote 转义表名, 列名.
+	Quote(ident string) string
+	//Limit 生成limit语句, 以空格开头.
+	Limit(offset, limit int) string
+	//Returning insert返回自增id的语句, 返回空时使用LastInsertId.
+	Returning(col string) string
+	//Upsert insert冲突时更新的语句, keys为冲突检测的列, update为需要更新的列, 不能生成时返回空.
+	Upsert(keys, update []string) string
+}
+
+const (
+	//DriverMySQL mysql, 需要导入驱动, 如dearcode.net/crab/orm/mysql.
+	DriverMySQL = "mysql"
+	//DriverPostgres postgres, 需要导入驱动, 如github.com/lib/pq.
+	DriverPostgres = "postgres"
+	//DriverSQLite sqlite3, 需要导入驱动, 如github.com/mattn/go-sqlite3.
+	DriverSQLite = "sqlite3"
+)
+
+var (
+	dialects = map[string]Dialect{
+		DriverMySQL:    MySQL{},
+		DriverPostgres: PostgreSQL{},
+		"pgx":          PostgreSQL{driver: "pgx"},
+		DriverSQLite:   SQLite{},
+		"sqlite":       SQLite{driver: "sqlite"},
+	}
+	dialectsMu sync.RWMutex
+)
+
+// RegisterDialect 注册驱动对应的Dialect, 可以覆盖已有的.
+func RegisterDialect(driver string, d Dialect) {
+	dialectsMu.Lock()
+	dialects[driver] = d
+	dialectsMu.Unlock()
+}
+
+// GetDialect 根据驱动名获取Dialect, 为空时返回MySQL.
+func GetDialect(driver string) (Dialect, error) {
+	if driver == "" {
+		driver = DriverMySQL
+	}
+
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, errors.Errorf("unsupported driver:%v", driver)
+	}
+	return d, nil
+}
+
+// MySQL mysql, 默认的Dialect.
+type MySQL struct {
+	//ConsecutiveIDs BatchInsert使用多行insert, 根据LastInsertId计算每行的id, 默认逐行插入获取准确的id.
+	//需要auto_increment_increment为1, 并且所有行的id都由数据库分配.
+	ConsecutiveIDs bool
+}
+
+// Name 实现Dialect.
+func (MySQL) Name() string {
+	return DriverMySQL
+}
+
+// DSN 实现Dialect.
+func (MySQL) DSN(db *DB) string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", db.UserName, db.Passwd, db.IP, db.Port, db.DBName)
+
+	if optStr := db.getOpt(); optStr != "" {
+		dsn = fmt.Sprintf("%s?%s", dsn, optStr)
+	}
+
+	return dsn
+}
+
+// Rebind 实现Dialect.
+func (MySQL) Rebind(query string) string {
+	return query
+}
+
+// Quote 实现Dialect.
+func (MySQL) Quote(ident string) string {
+	return quoteIdent(ident, "`")
+}
+
+// Limit 实现Dialect.
+func (MySQL) Limit(offset, limit int) string {
+	if offset > 0 {
+		return fmt.Sprintf(" limit %d,%d", offset, limit)
+	}
+	return fmt.Sprintf(" limit %d", limit)
+}
+
+// Returning 实现Dialect.
+func (MySQL) Returning(string) string {
+	return ""
+}
+
+// Upsert 实现Dialect, mysql根据唯一索引判断冲突, 忽略keys.
+func (d MySQL) Upsert(keys, update []string) string {
+	if len(update) == 0 {
+		if len(keys) == 0 {
+			return ""
+		}
+		//没有需要更新的列时, 更新为原值, 保证不报错.
+		update = keys[:1]
+	}
+
+	var sets []string
+	for _, c := range update {
+		c = d.Quote(c)
+		sets = append(sets, fmt.Sprintf("%s=values(%s)", c, c))
+	}
+	return " on duplicate key update " + strings.Join(sets, ", ")
+}
+
+// deleteLimiter 支持delete ... limit的数据库.
+type deleteLimiter interface {
+	DeleteLimit(limit int) string
+}
+
+// DeleteLimit delete语句的limit, 不支持offset, 其它数据库不支持delete limit.
+func (MySQL) DeleteLimit(limit int) string {
+	return fmt.Sprintf(" limit %d", limit)
+}
+
+// batchIDer 多行insert时可以根据LastInsertId计算每行id的数据库, BatchIDsEnabled返回false时逐行插入.
+type batchIDer interface {
+	BatchIDsEnabled() bool
+	BatchIDs(lastInsertID int64, n int) []int64
+}
+
+// BatchIDsEnabled 设置ConsecutiveIDs时才使用多行insert.
+func (d MySQL) BatchIDsEnabled() bool {
+	return d.ConsecutiveIDs
+}
+
+// BatchIDs mysql的LastInsertId为第一行的id, 后续连续递增.
+func (MySQL) BatchIDs(lastInsertID int64, n int) []int64 {
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = lastInsertID + int64(i)
+	}
+	return ids
+}
+
+// PostgreSQL postgres.
+type PostgreSQL struct {
+	driver string
+}
+
+// Name 实现Dialect.
+func (d PostgreSQL) Name() string {
+	if d.driver != "" {
+		return d.driver
+	}
+	return DriverPostgres
+}
+
+// DSN 实现Dialect.
+func (PostgreSQL) DSN(db *DB) string {
+	opts := []string{
+		"host=" + db.IP,
+		fmt.Sprintf("port=%d", db.Port),
+		"user=" + db.UserName,
+		"password=" + db.Passwd,
+		"dbname=" + db.DBName,
+		"sslmode=disable",
+	}
+
+	if db.Timeout > 0 {
+		opts = append(opts, fmt.Sprintf("connect_timeout=%d", db.Timeout))
+	}
+
+	return strings.Join(opts, " ")
+}
+
+// Rebind 实现Dialect, ?转换为$1, $2...
+func (PostgreSQL) Rebind(query string) string {
+	return rebindNumber(query, "$")
+}
+
+// Quote 实现Dialect.
+func (PostgreSQL) Quote(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+// Limit 实现Dialect.
+func (PostgreSQL) Limit(offset, limit int) string {
+	return limitOffset(offset, limit)
+}
+
+// Returning 实现Dialect.
+func (d PostgreSQL) Returning(col string) string {
+	return " returning " + d.Quote(col)
+}
+
+// Upsert 实现Dialect.
+func (d PostgreSQL) Upsert(keys, update []string) string {
+	return onConflict(d, keys, update)
+}
+
+// SQLite sqlite3, 默认使用returning获取自增id, 需要3.35以上版本.
+type SQLite struct {
+	driver string
+	//NoReturning 3.35以下版本不支持returning, 使用LastInsertId, BatchInsert逐行插入.
+	NoReturning bool
+}
+
+// Name 实现Dialect.
+func (d SQLite) Name() string {
+	if d.driver != "" {
+		return d.driver
+	}
+	return DriverSQLite
+}
+
+// DSN 实现Dialect, DBName为文件路径或:memory:.
+func (SQLite) DSN(db *DB) string {
+	return db.DBName
+}
+
+// Rebind 实现Dialect.
+func (SQLite) Rebind(query string) string {
+	return query
+}
+
+// Quote 实现Dialect.
+func (SQLite) Quote(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+// Limit 实现Dialect.
+func (SQLite) Limit(offset, limit int) string {
+	return limitOffset(offset, limit)
+}
+
+// Returning 实现Dialect.
+func (d SQLite) Returning(col string) string {
+	if d.NoReturning {
+		return ""
+	}
+	return " returning " + d.Quote(col)
+}
+
+// Upsert 实现Dialect, 需要sqlite 3.24以上版本.
+func (d SQLite) Upsert(keys, update []string) string {
+	return onConflict(d, keys, update)
+}
+
+func limitOffset(offset, limit int) string {
+	if offset > 0 {
+		return fmt.Sprintf(" limit %d offset %d", limit, offset)
+	}
+	return fmt.Sprintf(" limit %d", limit)
+}
+
+func onConflict(d Dialect, keys, update []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	var ks []string
+	for _, k := range keys {
+		ks = append(ks, d.Quote(k))
+	}
+
+	if len(update) == 0 {
+		return fmt.Sprintf(" on conflict (%s) do nothing", strings.Join(ks, ", "))
+	}
+
+	var sets []string
+	for _, c := range update {
+		c = d.Quote(c)
+		sets = append(sets, fmt.Sprintf("%s=excluded.%s", c, c))
+	}
+	return fmt.Sprintf(" on conflict (%s) do update set %s", strings.Join(ks, ", "), strings.Join(sets, ", "))
+}
+
+// quoteIdent 转义标识符, 带表名的分别转义, 已转义的部分不处理, 其中的引号转义为两个引号.
+func quoteIdent(ident, q string) string {
+	if ident == "" {
+		return ident
+	}
+
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if len(p) > 1 && strings.HasPrefix(p, q) && strings.HasSuffix(p, q) {
+			continue
+		}
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+// rebindNumber 把引号外的?替换为prefix加序号.
+func rebindNumber(query, prefix string) string {
+	var bs bytes.Buffer
+	var quote byte
+	n := 0
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?':
+			n++
+			bs.WriteString(prefix)
+			bs.WriteString(strconv.Itoa(n))
+			continue
+		}
+		bs.WriteByte(ch)
+	}
+
+	return bs.String()
+}
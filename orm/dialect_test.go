@@ -0,0 +1,115 @@
+package orm
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestDialectSQL(t *testing.T) {
+	result := []struct {
+		ID   int64
+		User string
+	}{}
+
+	cases := []struct {
+		d      Dialect
+		expect string
+	}{
+		{MySQL{}, "select userinfo.id, userinfo.user from userinfo where id > ? limit 5,10"},
+		{PostgreSQL{}, "select userinfo.id, userinfo.user from userinfo where id > ? limit 10 offset 5"},
+		{SQLite{}, "select userinfo.id, userinfo.user from userinfo where id > ? limit 10 offset 5"},
+	}
+
+	for _, c := range cases {
+		sql, err := NewStmt(nil, "userinfo").SetDialect(c.d).Where("id > ?", 1).Limit(10).Offset(5).sqlQueryBuilder(&result)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if sql != c.expect {
+			t.Fatalf("%v expect:%s\n recv:%s", c.d.Name(), c.expect, sql)
+		}
+	}
+
+	if s := (PostgreSQL{}).Rebind("a = ? and b = '?' and c in (?, ?)"); s != "a = $1 and b = '?' and c in ($2, $3)" {
+		t.Fatalf("unexpected rebind:%v", s)
+	}
+
+	if s := (MySQL{}).Upsert([]string{"id"}, []string{"name", "age"}); s != " on duplicate key update `name`=values(`name`), `age`=values(`age`)" {
+		t.Fatalf("unexpected mysql upsert:%v", s)
+	}
+
+	if s := (MySQL{}).Quote("db.user`s"); s != "`db`.`user``s`" {
+		t.Fatalf("unexpected mysql quote:%v", s)
+	}
+
+	if s := (PostgreSQL{}).Quote(`"db".a"b`); s != `"db"."a""b"` {
+		t.Fatalf("unexpected postgres quote:%v", s)
+	}
+
+	if s := (SQLite{}).Upsert([]string{"id"}, []string{"name"}); s != ` on conflict ("id") do update set "name"=excluded."name"` {
+		t.Fatalf("unexpected sqlite upsert:%v", s)
+	}
+}
+
+func TestDialectDSN(t *testing.T) {
+	db := NewDB("127.0.0.1", 5432, "crab", "root", "pass", "", 3)
+
+	if dsn := db.getDSN(); dsn != "root:pass@tcp(127.0.0.1:5432)/crab?timeout=3s&maxAllowedPacket=134217728" {
+		t.Fatalf("unexpected mysql dsn:%v", dsn)
+	}
+
+	db.ConsecutiveIDs = true
+	if d, ok := db.Dialect().(MySQL); !ok || !d.BatchIDsEnabled() {
+		t.Fatalf("expect mysql with consecutive ids, recv:%#v", db.Dialect())
+	}
+
+	db.Driver = DriverPostgres
+	if dsn := db.getDSN(); dsn != "host=127.0.0.1 port=5432 user=root password=pass dbname=crab sslmode=disable connect_timeout=3" {
+		t.Fatalf("unexpected postgres dsn:%v", dsn)
+	}
+
+	//没有导入的驱动返回未注册.
+	if _, err := db.GetConnection(); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Fatalf("expect postgres driver not registered, recv:%v", err)
+	}
+
+	db.Driver = "oracle"
+	if _, err := db.GetConnection(); err == nil {
+		t.Fatalf("expect unsupported driver error")
+	}
+}
+
+func TestPostgresInsertUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	data := struct {
+		ID   int64 `db_auto:""`
+		User string
+	}{User: "crab"}
+
+	mock.ExpectQuery(`insert into userinfo \(user\) values \(\$1\) returning "id"`).WithArgs("crab").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`update "userinfo" set "user"=\$1 where id = \$2`).WithArgs("crab", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	pg := &DB{Driver: DriverPostgres}
+
+	id, err := pg.NewStmt(db, "userinfo").Insert(&data)
+	if err != nil || id != 7 {
+		t.Fatalf("expect id 7, recv:%v, err:%v", id, err)
+	}
+
+	if _, err = pg.NewStmt(db, "userinfo").Where("id = ?", id).Update(&data); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
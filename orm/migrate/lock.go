@@ -0,0 +1,81 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"time"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/orm"
+)
+
+// Locker Dialect可以实现Locker自定义迁移锁, 返回释放锁的函数, 优先于内置的锁.
+type Locker interface {
+	MigrateLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (func(), error)
+}
+
+// lock 在conn上获取迁移锁, mysql使用get_lock, postgres使用advisory lock, sqlite写操作本身串行不加锁.
+// 其它数据库需要实现Locker, 或者调用SkipLock.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	if m.skipLock {
+		return func() {}, nil
+	}
+
+	name := "crab_migrate_" + m.table
+
+	if l, ok := m.dialect.(Locker); ok {
+		return l.MigrateLock(ctx, conn, name, m.lockTimeout)
+	}
+
+	switch m.dialect.Name() {
+	case orm.DriverMySQL:
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "select get_lock(?, ?)", name, int64(m.lockTimeout.Seconds())).Scan(&ok); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if ok.Int64 != 1 {
+			return nil, errors.Trace(ErrLocked)
+		}
+		return func() {
+			conn.ExecContext(context.Background(), "select release_lock(?)", name)
+		}, nil
+	case orm.DriverPostgres, "pgx":
+		key := lockKey(name)
+		if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", key); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return func() {
+			conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", key)
+		}, nil
+	case orm.DriverSQLite, "sqlite":
+		return func() {}, nil
+	}
+
+	return nil, errors.Annotatef(ErrLockUnsupported, "driver:%v", m.dialect.Name())
+}
+
+// lockKey advisory lock的key.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// connExecutor *sql.Conn实现orm.Executor, 保证事务与锁在同一个连接上.
+type connExecutor struct {
+	*sql.Conn
+}
+
+func (c *connExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c *connExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c *connExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
@@ -0,0 +1,375 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/log"
+	"dearcode.net/crab/orm"
+)
+
+const (
+	//DefaultTable 默认的迁移记录表.
+	DefaultTable = "schema_migrations"
+	//defaultLockTimeout 等待其它实例迁移完成的最长时间.
+	defaultLockTimeout = time.Minute
+)
+
+var (
+	//ErrLocked 其它实例正在迁移.
+	ErrLocked = errors.New("migration locked by other instance")
+	//ErrLockUnsupported 数据库不支持迁移锁, 需要实现Locker或调用SkipLock.
+	ErrLockUnsupported = errors.New("migration lock unsupported")
+	//ErrNoDown 迁移没有down文件, 不能回滚.
+	ErrNoDown = errors.New("migration has no down sql")
+
+	fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+// Migration 一个版本的迁移, 对应NNNN_name.up.sql及NNNN_name.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status 迁移的执行状态.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Load 从fsys根目录加载迁移文件, 按版本号排序, embed.FS可以使用fs.Sub指定目录.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ms := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		sub := fileRegexp.FindStringSubmatch(e.Name())
+		if sub == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(sub[1], 10, 64)
+		m, ok := ms[version]
+		if !ok {
+			m = &Migration{Version: version, Name: sub[2]}
+			ms[version] = m
+		}
+		if m.Name != sub[2] {
+			return nil, errors.Errorf("version %v duplicate, name:%v, %v", version, m.Name, sub[2])
+		}
+
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if sub[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	var list []Migration
+	for _, m := range ms {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, errors.Errorf("version %v no up sql", m.Version)
+		}
+		list = append(list, *m)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// LoadDir 从目录加载迁移文件.
+func LoadDir(dir string) ([]Migration, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Migrator 迁移执行器, 执行时加锁, 同一时间只有一个实例迁移.
+// 每个迁移在一个事务中执行, 注意mysql的DDL会隐式提交, 失败时可能需要手动处理.
+type Migrator struct {
+	db          *sql.DB
+	dialect     orm.Dialect
+	migrations  []Migration
+	table       string
+	lockTimeout time.Duration
+	dryRun      io.Writer
+	skipLock    bool
+	logger      *log.Logger
+}
+
+// New 创建Migrator, ms为Load返回的迁移.
+func New(db *sql.DB, d orm.Dialect, ms []Migration) *Migrator {
+	return &Migrator{
+		db:          db,
+		dialect:     d,
+		migrations:  ms,
+		table:       DefaultTable,
+		lockTimeout: defaultLockTimeout,
+	}
+}
+
+// SetTable 设置迁移记录表名.
+func (m *Migrator) SetTable(table string) *Migrator {
+	m.table = table
+	return m
+}
+
+// SetLockTimeout 设置等待锁的最长时间, mysql有效, postgres一直等待.
+func (m *Migrator) SetLockTimeout(d time.Duration) *Migrator {
+	m.lockTimeout = d
+	return m
+}
+
+// SetDryRun 只把要执行的sql输出到w, 不修改数据库, w为nil时关闭.
+func (m *Migrator) SetDryRun(w io.Writer) *Migrator {
+	m.dryRun = w
+	return m
+}
+
+// SkipLock 迁移时不加锁, 用于不支持加锁的数据库, 调用方需要保证同一时间只有一个实例迁移.
+func (m *Migrator) SkipLock() *Migrator {
+	m.skipLock = true
+	return m
+}
+
+// SetLogger 输出log.
+func (m *Migrator) SetLogger(l *log.Logger) *Migrator {
+	m.logger = l
+	return m
+}
+
+// Up 执行版本号不大于target的未执行迁移, target为0时执行全部, 返回执行了的迁移.
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	var done []Migration
+
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for _, mg := range m.migrations {
+			if target > 0 && mg.Version > target {
+				break
+			}
+			if applied[mg.Version] {
+				continue
+			}
+
+			record := fmt.Sprintf("insert into %s (version, name) values (?, ?)", m.dialect.Quote(m.table))
+			if err := m.apply(ctx, conn, mg, mg.Up, record, mg.Version, mg.Name); err != nil {
+				return errors.Annotatef(err, "up %v_%v", mg.Version, mg.Name)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+
+	return done, errors.Trace(err)
+}
+
+// Down 按版本号倒序回滚最近执行的steps个迁移, steps小于1时回滚一个.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		steps = 1
+	}
+
+	var done []Migration
+
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if !applied[mg.Version] {
+				continue
+			}
+			if strings.TrimSpace(mg.Down) == "" {
+				return errors.Annotatef(ErrNoDown, "%v_%v", mg.Version, mg.Name)
+			}
+
+			record := fmt.Sprintf("delete from %s where version = ?", m.dialect.Quote(m.table))
+			if err := m.apply(ctx, conn, mg, mg.Down, record, mg.Version); err != nil {
+				return errors.Annotatef(err, "down %v_%v", mg.Version, mg.Name)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+
+	return done, errors.Trace(err)
+}
+
+// Status 返回所有迁移的执行状态.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var list []Status
+
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for _, mg := range m.migrations {
+			list = append(list, Status{Migration: mg, Applied: applied[mg.Version]})
+		}
+		return nil
+	})
+
+	return list, errors.Trace(err)
+}
+
+// run 获取连接并加锁, 创建记录表, 查询已执行的版本后调用fn.
+func (m *Migrator) run(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]bool) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if m.dryRun == nil {
+		unlock, err := m.lock(ctx, conn)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer unlock()
+
+		if _, err = conn.ExecContext(ctx, m.createTable()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		if m.dryRun == nil {
+			return errors.Trace(err)
+		}
+		//dry-run时记录表可能还不存在.
+		fmt.Fprintf(m.dryRun, "%s;\n", m.createTable())
+		applied = make(map[int64]bool)
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) createTable() string {
+	return fmt.Sprintf("create table if not exists %s (version bigint not null primary key, name varchar(255) not null, applied_at timestamp not null default current_timestamp)", m.dialect.Quote(m.table))
+}
+
+// applied 查询已执行的版本.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("select version from %s", m.dialect.Quote(m.table)))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	vs := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err = rows.Scan(&v); err != nil {
+			return nil, errors.Trace(err)
+		}
+		vs[v] = true
+	}
+
+	return vs, errors.Trace(rows.Err())
+}
+
+// apply 在事务中执行query中的语句及修改记录表的record.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, query, record string, args ...interface{}) error {
+	stmts := splitStatements(query)
+	record = m.dialect.Rebind(record)
+
+	if m.dryRun != nil {
+		fmt.Fprintf(m.dryRun, "-- %d_%s\n", mg.Version, mg.Name)
+		for _, s := range stmts {
+			fmt.Fprintf(m.dryRun, "%s;\n", s)
+		}
+		fmt.Fprintf(m.dryRun, "%s; -- %v\n", record, args)
+		return nil
+	}
+
+	m.logger.Infof("migrate %d_%s", mg.Version, mg.Name)
+
+	return orm.WithTx(ctx, &connExecutor{conn}, func(tx *orm.Tx) error {
+		for _, s := range stmts {
+			m.logger.Debugf("sql:%v", s)
+			if _, err := tx.ExecContext(ctx, s); err != nil {
+				return errors.Annotatef(err, s)
+			}
+		}
+		_, err := tx.ExecContext(ctx, record, args...)
+		return errors.Trace(err)
+	})
+}
+
+// splitStatements 按引号外的分号拆分sql语句, 去掉--及/* */注释, 保留mysql的/*! */, 不支持postgres的$$函数体.
+func splitStatements(query string) []string {
+	var list []string
+	var bs bytes.Buffer
+	var quote byte
+
+	add := func() {
+		if s := strings.TrimSpace(bs.String()); s != "" {
+			list = append(list, s)
+		}
+		bs.Reset()
+	}
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			//跳过注释到行尾.
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+				continue
+			}
+			i += end
+			ch = '\n'
+		case ch == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+				continue
+			}
+			end += i + 4
+			//mysql的/*! */是需要执行的语句.
+			if i+2 < len(query) && query[i+2] == '!' {
+				bs.WriteString(query[i:end])
+			}
+			i = end - 1
+			ch = ' '
+		case ch == ';':
+			add()
+			continue
+		}
+		bs.WriteByte(ch)
+	}
+
+	add()
+
+	return list
+}
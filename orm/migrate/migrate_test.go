@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"dearcode.net/crab/orm"
+)
+
+var testFS = fstest.MapFS{
+	"0001_create_user.up.sql":   {Data: []byte("create table user (id bigint); -- user table;\ninsert into user values (1);")},
+	"0001_create_user.down.sql": {Data: []byte("drop table user;")},
+	"0002_add_name.up.sql":      {Data: []byte("alter table user add name varchar(32) default 'a;b';")},
+	"readme.txt":                {Data: []byte("ignore")},
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(testFS)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(ms) != 2 || ms[0].Version != 1 || ms[0].Name != "create_user" || ms[0].Down == "" || ms[1].Version != 2 || ms[1].Down != "" {
+		t.Fatalf("unexpected migrations:%+v", ms)
+	}
+
+	bad := fstest.MapFS{"0001_a.up.sql": {Data: []byte("select 1")}, "0001_b.up.sql": {Data: []byte("select 1")}}
+	if _, err = Load(bad); err == nil {
+		t.Fatalf("expect duplicate version error")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	expect := []string{"create table user (id bigint)", "insert into user values (1)"}
+	if ss := splitStatements(string(testFS["0001_create_user.up.sql"].Data)); !reflect.DeepEqual(ss, expect) {
+		t.Fatalf("expect:%q, recv:%q", expect, ss)
+	}
+
+	expect = []string{"create table a (id bigint  )", "/*!40101 set names utf8 */", "insert into a values ('/*;*/')"}
+	query := "/* create a;\n */ create table a (id bigint /* id; */);\n/*!40101 set names utf8 */;\ninsert into a values ('/*;*/'); /* end"
+	if ss := splitStatements(query); !reflect.DeepEqual(ss, expect) {
+		t.Fatalf("expect:%q, recv:%q", expect, ss)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ms, err := Load(testFS)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m := New(db, orm.MySQL{}, ms).SetLockTimeout(time.Second)
+
+	mock.ExpectQuery(`select get_lock\(\?, \?\)`).WithArgs("crab_migrate_schema_migrations", 1).WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(1))
+	mock.ExpectExec("create table if not exists `schema_migrations`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version from `schema_migrations`").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("alter table user add name").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into `schema_migrations`").WithArgs(2, "add_name").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`select release_lock\(\?\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	done, err := m.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("unexpected up:%+v", done)
+	}
+
+	//down 2没有down文件.
+	mock.ExpectQuery(`select get_lock`).WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(1))
+	mock.ExpectExec("create table if not exists").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+	mock.ExpectExec(`select release_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if _, err = m.Down(context.Background(), 1); err == nil || !strings.Contains(err.Error(), ErrNoDown.Error()) {
+		t.Fatalf("expect ErrNoDown, recv:%v", err)
+	}
+
+	mock.ExpectQuery(`select get_lock`).WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(0))
+	if _, err = m.Status(context.Background()); err == nil || !strings.Contains(err.Error(), ErrLocked.Error()) {
+		t.Fatalf("expect ErrLocked, recv:%v", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//不支持加锁的数据库需要SkipLock.
+	m = New(db, unknownDialect{}, ms)
+	if _, err = m.Status(context.Background()); err == nil || !strings.Contains(err.Error(), ErrLockUnsupported.Error()) {
+		t.Fatalf("expect ErrLockUnsupported, recv:%v", err)
+	}
+
+	mock.ExpectExec("create table if not exists `schema_migrations`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version from `schema_migrations`").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+	list, err := m.SkipLock().Status(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(list) != 2 || !list[0].Applied || list[1].Applied {
+		t.Fatalf("unexpected status:%+v", list)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// unknownDialect 没有内置迁移锁的数据库.
+type unknownDialect struct {
+	orm.MySQL
+}
+
+func (unknownDialect) Name() string {
+	return "unknown"
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ms, err := Load(testFS)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var out bytes.Buffer
+	m := New(db, orm.PostgreSQL{}, ms).SetDryRun(&out)
+
+	mock.ExpectQuery(`select version from "schema_migrations"`).WillReturnError(sql.ErrNoRows)
+
+	if _, err = m.Up(context.Background(), 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expect := `create table if not exists "schema_migrations" (version bigint not null primary key, name varchar(255) not null, applied_at timestamp not null default current_timestamp);
+-- 1_create_user
+create table user (id bigint);
+insert into user values (1);
+insert into "schema_migrations" (version, name) values ($1, $2); -- [1 create_user]
+`
+	if out.String() != expect {
+		t.Fatalf("expect:%s\nrecv:%s", expect, out.String())
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
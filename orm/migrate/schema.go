@@ -0,0 +1,224 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/orm"
+	"dearcode.net/crab/util/str"
+)
+
+// Column 建表的列, 由结构体字段及orm的标签生成.
+type Column struct {
+	Name string
+	//Type go类型, 如int64, string, time.Time, 使用db:",json"的为json.
+	Type string
+	//SQLType db_type标签指定的类型, 不为空时忽略Type.
+	SQLType string
+	//Null 指针及sql.Null*类型可以为NULL.
+	Null bool
+	//Auto db_auto标签或ID字段, 自增主键.
+	Auto bool
+	//Default db_default标签.
+	Default string
+}
+
+var (
+	//sqlTypes go类型对应的mysql, postgres, sqlite类型.
+	sqlTypes = map[string][3]string{
+		"bool":      {"tinyint(1)", "boolean", "integer"},
+		"int8":      {"tinyint", "smallint", "integer"},
+		"uint8":     {"tinyint unsigned", "smallint", "integer"},
+		"int16":     {"smallint", "smallint", "integer"},
+		"uint16":    {"smallint unsigned", "integer", "integer"},
+		"int32":     {"int", "integer", "integer"},
+		"uint32":    {"int unsigned", "bigint", "integer"},
+		"int":       {"bigint", "bigint", "integer"},
+		"int64":     {"bigint", "bigint", "integer"},
+		"uint":      {"bigint unsigned", "bigint", "integer"},
+		"uint64":    {"bigint unsigned", "bigint", "integer"},
+		"float32":   {"float", "real", "real"},
+		"float64":   {"double", "double precision", "real"},
+		"string":    {"varchar(255)", "varchar(255)", "text"},
+		"[]byte":    {"blob", "bytea", "blob"},
+		"time.Time": {"datetime", "timestamp", "datetime"},
+		"json":      {"json", "jsonb", "text"},
+	}
+
+	//aliases 同一类型的不同写法及sql.Null*对应的类型.
+	aliases = map[string]string{
+		"byte":            "uint8",
+		"rune":            "int32",
+		"[]uint8":         "[]byte",
+		"sql.NullString":  "string",
+		"sql.NullInt64":   "int64",
+		"sql.NullInt32":   "int32",
+		"sql.NullInt16":   "int16",
+		"sql.NullByte":    "uint8",
+		"sql.NullFloat64": "float64",
+		"sql.NullBool":    "bool",
+		"sql.NullTime":    "time.Time",
+	}
+)
+
+// ParseColumn 根据字段名, go类型及标签生成列, 与orm一样忽略db_ignore, db_table及不是json的切片字段.
+func ParseColumn(field, typ string, tag reflect.StructTag) (Column, bool) {
+	if _, ok := tag.Lookup("db_ignore"); ok || tag.Get("db_table") != "" {
+		return Column{}, false
+	}
+
+	name, opt := tag.Get("db"), ""
+	if idx := strings.Index(name, ","); idx > -1 {
+		name, opt = name[:idx], name[idx+1:]
+	}
+	if name == "" {
+		name = str.FieldEscape(field)
+	}
+
+	c := Column{Name: name, SQLType: tag.Get("db_type"), Default: tag.Get("db_default")}
+	if _, ok := tag.Lookup("db_auto"); ok || field == "ID" {
+		c.Auto = true
+	}
+
+	if strings.HasPrefix(typ, "*") {
+		c.Null = true
+		typ = typ[1:]
+	}
+
+	if strings.HasPrefix(typ, "sql.Null") {
+		c.Null = true
+	}
+
+	if a, ok := aliases[typ]; ok {
+		typ = a
+	}
+
+	switch {
+	case opt == "json":
+		typ = "json"
+	case c.SQLType == "" && typ != "[]byte" && (strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[")):
+		return Column{}, false
+	}
+
+	c.Type = typ
+	return c, true
+}
+
+// Columns 通过反射解析obj(结构体或指针)的列.
+func Columns(obj interface{}) ([]Column, error) {
+	rt := reflect.TypeOf(obj)
+	if rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return nil, errors.Errorf("obj must be struct, recv:%v", rt)
+	}
+
+	var cols []Column
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+
+		if c, ok := ParseColumn(f.Name, typeName(f.Type), f.Tag); ok {
+			cols = append(cols, c)
+		}
+	}
+
+	return cols, nil
+}
+
+// typeName 反射类型对应的go类型, 自定义的基础类型使用底层类型.
+func typeName(rt reflect.Type) string {
+	if rt.Kind() == reflect.Ptr {
+		return "*" + typeName(rt.Elem())
+	}
+
+	name := rt.String()
+	if _, ok := sqlTypes[name]; ok {
+		return name
+	}
+	if _, ok := aliases[name]; ok {
+		return name
+	}
+
+	if rt.Kind() <= reflect.Float64 || rt.Kind() == reflect.String {
+		return rt.Kind().String()
+	}
+	return name
+}
+
+// CreateTable 生成建表语句, 自增列为主键.
+func CreateTable(d orm.Dialect, table string, cols []Column) (string, error) {
+	if len(cols) == 0 {
+		return "", errors.Errorf("table %v no column", table)
+	}
+
+	idx := 0
+	switch d.(type) {
+	case orm.PostgreSQL:
+		idx = 1
+	case orm.SQLite:
+		idx = 2
+	}
+
+	bs := bytes.NewBufferString("create table if not exists ")
+	bs.WriteString(d.Quote(table))
+	bs.WriteString(" (\n")
+
+	for i, c := range cols {
+		fmt.Fprintf(bs, "  %s ", d.Quote(c.Name))
+
+		if c.Auto && c.SQLType == "" {
+			bs.WriteString([3]string{"bigint not null auto_increment primary key", "bigserial primary key", "integer primary key autoincrement"}[idx])
+		} else {
+			typ := c.SQLType
+			if typ == "" {
+				ts, ok := sqlTypes[c.Type]
+				if !ok {
+					return "", errors.Errorf("column %v unsupported type:%v, use db_type tag", c.Name, c.Type)
+				}
+				typ = ts[idx]
+			}
+			bs.WriteString(typ)
+
+			if c.Auto {
+				bs.WriteString(" primary key")
+			} else if !c.Null {
+				bs.WriteString(" not null")
+			}
+
+			if c.Default != "" {
+				//db_default中的now()是insert时的表达式, 建表时使用标准的current_timestamp.
+				def := c.Default
+				if strings.EqualFold(def, "now()") {
+					def = "current_timestamp"
+				}
+				bs.WriteString(" default " + def)
+			}
+		}
+
+		if i < len(cols)-1 {
+			bs.WriteString(",")
+		}
+		bs.WriteString("\n")
+	}
+
+	bs.WriteString(")")
+
+	return bs.String(), nil
+}
+
+// CreateTableFor 根据结构体生成建表语句.
+func CreateTableFor(d orm.Dialect, table string, obj interface{}) (string, error) {
+	cols, err := Columns(obj)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return CreateTable(d, table, cols)
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"dearcode.net/crab/orm"
+)
+
+type schemaState int
+
+type schemaUser struct {
+	ID      int64
+	Name    string `db:"user_name"`
+	Email   *string
+	Phone   sql.NullString
+	State   schemaState
+	Attr    map[string]string    `db:",json"`
+	Remark  string               `db_type:"text"`
+	Ctime   time.Time            `db_default:"now()"`
+	Skip    string               `db_ignore:""`
+	Post    []struct{ ID int64 } `db_table:"one2more"`
+	private int
+}
+
+func TestCreateTable(t *testing.T) {
+	cases := []struct {
+		d      orm.Dialect
+		expect string
+	}{
+		{orm.MySQL{}, "create table if not exists `schema_user` (\n" +
+			"  `id` bigint not null auto_increment primary key,\n" +
+			"  `user_name` varchar(255) not null,\n" +
+			"  `email` varchar(255),\n" +
+			"  `phone` varchar(255),\n" +
+			"  `state` bigint not null,\n" +
+			"  `attr` json not null,\n" +
+			"  `remark` text not null,\n" +
+			"  `ctime` datetime not null default current_timestamp\n)"},
+		{orm.PostgreSQL{}, "create table if not exists \"schema_user\" (\n" +
+			"  \"id\" bigserial primary key,\n" +
+			"  \"user_name\" varchar(255) not null,\n" +
+			"  \"email\" varchar(255),\n" +
+			"  \"phone\" varchar(255),\n" +
+			"  \"state\" bigint not null,\n" +
+			"  \"attr\" jsonb not null,\n" +
+			"  \"remark\" text not null,\n" +
+			"  \"ctime\" timestamp not null default current_timestamp\n)"},
+		{orm.SQLite{}, "create table if not exists \"schema_user\" (\n" +
+			"  \"id\" integer primary key autoincrement,\n" +
+			"  \"user_name\" text not null,\n" +
+			"  \"email\" text,\n" +
+			"  \"phone\" text,\n" +
+			"  \"state\" integer not null,\n" +
+			"  \"attr\" text not null,\n" +
+			"  \"remark\" text not null,\n" +
+			"  \"ctime\" datetime not null default current_timestamp\n)"},
+	}
+
+	for _, c := range cases {
+		sql, err := CreateTableFor(c.d, "schema_user", &schemaUser{})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if sql != c.expect {
+			t.Fatalf("%v expect:\n%s\nrecv:\n%s", c.d.Name(), c.expect, sql)
+		}
+	}
+
+	if _, err := CreateTable(orm.MySQL{}, "t", []Column{{Name: "c", Type: "pkg.Unknown"}}); err == nil {
+		t.Fatalf("expect unsupported type error")
+	}
+}
@@ -0,0 +1,387 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"dearcode.net/crab/util/str"
+)
+
+// model 结构体解析后的字段及标签信息, 每个类型只解析一次.
+type model struct {
+	//columns 查询的列, 按字段顺序, 包含一对一子结构.
+	columns []column
+	//scans 查询结果的扫描字段.
+	scans []scan
+	//id ID字段在scans中的位置.
+	id int
+	//relations 一对多关联.
+	relations []relation
+	//inserts insert的字段.
+	inserts []field
+	//updates update的字段.
+	updates []field
+	//auto 自增列名.
+	auto string
+}
+
+// column 查询列, one不为空时为一对一子结构.
+type column struct {
+	name     string
+	distinct bool
+	//qualify 需要加表名前缀.
+	qualify bool
+	one     *oneTable
+}
+
+// oneTable db_table:"one"的子结构.
+type oneTable struct {
+	table    string
+	relField string
+	model    *model
+}
+
+// relation db_table为more或one2more的切片字段.
+type relation struct {
+	index   int
+	name    string
+	kind    string
+	preload bool
+	typ     reflect.Type
+}
+
+// field insert, update的字段, val不为空时使用val作为值, 否则绑定参数.
+type field struct {
+	index int
+	key   string
+	val   string
+	//def 有db_default标签.
+	def bool
+	//json 使用json保存.
+	json bool
+	//addr 指针类型实现了driver.Valuer, 需要取地址.
+	addr bool
+}
+
+const (
+	//scanDirect 直接扫描到字段, 指针及sql.Scanner可以处理NULL.
+	scanDirect = iota
+	//scanNull 先扫描到指针, NULL时保留零值.
+	scanNull
+	//scanJSON 解析json.
+	scanJSON
+)
+
+// scan 查询结果的扫描字段, index为字段位置, 一对一子结构为两层.
+type scan struct {
+	index []int
+	kind  int
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+var models sync.Map
+
+// getModel 获取rt的model, 没有时解析并缓存.
+func getModel(rt reflect.Type) *model {
+	if m, ok := models.Load(rt); ok {
+		return m.(*model)
+	}
+
+	m, _ := models.LoadOrStore(rt, parseModel(rt))
+	return m.(*model)
+}
+
+func parseModel(rt reflect.Type) *model {
+	m := &model{auto: autoColumn(rt)}
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+
+		if key, val, ok := structField(f, false); ok {
+			_, def := f.Tag.Lookup("db_default")
+			m.inserts = append(m.inserts, newField(i, f, key, val, def))
+		}
+		if key, val, ok := structField(f, true); ok {
+			m.updates = append(m.updates, newField(i, f, key, val, false))
+		}
+
+		if f.PkgPath != "" && !f.Anonymous { // unexported
+			continue
+		}
+
+		if f.Name == "ID" {
+			m.id = len(m.scans)
+		}
+
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			if f.Tag.Get("db_table") == "one" {
+				m.parseOne(i, f)
+				continue
+			}
+		case reflect.Slice:
+			if _, opt := dbTag(f); opt == "json" {
+				break
+			}
+			if kind := f.Tag.Get("db_table"); kind == "more" || kind == "one2more" {
+				_, preload := f.Tag.Lookup("db_preload")
+				m.relations = append(m.relations, relation{index: i, name: f.Name, kind: kind, preload: preload, typ: f.Type})
+			}
+			continue
+		}
+
+		m.scans = append(m.scans, scan{index: []int{i}, kind: scanKind(f)})
+		m.columns = append(m.columns, parseColumn(f))
+	}
+
+	return m
+}
+
+// parseOne 解析一对一子结构, 这里扫描字段只展开一层.
+func (m *model) parseOne(i int, f reflect.StructField) {
+	table := str.FieldEscape(f.Name)
+	relField := f.Tag.Get("db_relation_field")
+	if relField == "" {
+		relField = table + "_id"
+	}
+
+	m.columns = append(m.columns, column{one: &oneTable{table: table, relField: relField, model: getModel(f.Type)}})
+
+	for j := 0; j < f.Type.NumField(); j++ {
+		sf := f.Type.Field(j)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		if _, opt := dbTag(sf); sf.Type.Kind() == reflect.Slice && opt != "json" {
+			continue
+		}
+		m.scans = append(m.scans, scan{index: []int{i, j}, kind: scanKind(sf)})
+	}
+}
+
+// dbTag 解析db标签, 返回列名及选项, 如db:"user,distinct", db:",json".
+func dbTag(f reflect.StructField) (name, opt string) {
+	name = f.Tag.Get("db")
+	if idx := strings.Index(name, ","); idx > -1 {
+		return name[:idx], name[idx+1:]
+	}
+	return name, ""
+}
+
+func parseColumn(f reflect.StructField) column {
+	var c column
+	var opt string
+
+	c.name, opt = dbTag(f)
+	c.distinct = opt == "distinct"
+
+	if c.name == "" {
+		c.name = str.FieldEscape(f.Name)
+	}
+
+	c.qualify = !strings.Contains(c.name, ".") && !strings.Contains(c.name, "(")
+	return c
+}
+
+// structField 解析结构体中的字段，根据default及db值内容生成对应key ,value.
+func structField(f reflect.StructField, isUpdate bool) (key string, val string, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous { // unexported
+		return
+	}
+
+	_, opt := dbTag(f)
+	if opt != "json" && !valueType(f.Type) {
+		return
+	}
+
+	if _, ignore := f.Tag.Lookup("db_auto"); ignore {
+		return
+	}
+
+	if _, ignore := f.Tag.Lookup("db_ignore"); ignore {
+		return
+	}
+
+	if key, _ = dbTag(f); key == "" {
+		key = str.FieldEscape(f.Name)
+	}
+
+	//insert 解析default
+	if !isUpdate {
+		if val, ok = f.Tag.Lookup("db_default"); ok {
+			return
+		}
+	}
+
+	if val, ok = f.Tag.Lookup("db_const"); ok {
+		return
+	}
+
+	return key, "", true
+}
+
+// autoColumn 自增列名, 为db_auto标签或ID字段.
+func autoColumn(rt reflect.Type) string {
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if _, ok := f.Tag.Lookup("db_auto"); !ok && f.Name != "ID" {
+			continue
+		}
+		if key, _ := dbTag(f); key != "" {
+			return key
+		}
+		return str.FieldEscape(f.Name)
+	}
+	return ""
+}
+
+// valueType 可以直接作为绑定参数的类型, 结构体(time.Time除外), 切片等需要实现driver.Valuer, 指针为nil时写入NULL.
+func valueType(rt reflect.Type) bool {
+	if rt == timeType || rt.Implements(valuerType) || reflect.PtrTo(rt).Implements(valuerType) {
+		return true
+	}
+
+	switch rt.Kind() {
+	case reflect.Ptr:
+		return rt.Elem() == timeType || rt.Elem().Kind() != reflect.Struct && valueType(rt.Elem())
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array, reflect.Chan, reflect.Func:
+		return false
+	}
+
+	return true
+}
+
+func newField(i int, f reflect.StructField, key, val string, def bool) field {
+	_, opt := dbTag(f)
+	return field{
+		index: i,
+		key:   key,
+		val:   val,
+		def:   def,
+		json:  opt == "json",
+		addr:  !f.Type.Implements(valuerType) && reflect.PtrTo(f.Type).Implements(valuerType),
+	}
+}
+
+// value 生成字段对应的绑定参数.
+func (f field) value(rv reflect.Value) (interface{}, error) {
+	v := rv.Field(f.index)
+
+	switch {
+	case f.json:
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			if v.IsNil() {
+				return nil, nil
+			}
+		}
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, errors.Annotatef(err, "field:%v", f.key)
+		}
+		return string(b), nil
+	case f.addr:
+		if v.CanAddr() {
+			return v.Addr().Interface(), nil
+		}
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface(), nil
+	}
+
+	return v.Interface(), nil
+}
+
+func scanKind(f reflect.StructField) int {
+	if _, opt := dbTag(f); opt == "json" {
+		return scanJSON
+	}
+
+	switch f.Type.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return scanDirect
+	}
+
+	if reflect.PtrTo(f.Type).Implements(scannerType) {
+		return scanDirect
+	}
+
+	return scanNull
+}
+
+// fieldOf 返回扫描字段对应的值.
+func (sc scan) fieldOf(obj reflect.Value) reflect.Value {
+	v := obj.Field(sc.index[0])
+	if len(sc.index) > 1 {
+		v = v.Field(sc.index[1])
+	}
+	return v
+}
+
+// scanRefs 生成obj各列的扫描地址, scanNull的列扫描到指针中, 需要调用assign赋值.
+// refs为上一行的结果时复用, scanNull的指针只在第一行创建.
+func (m *model) scanRefs(obj reflect.Value, refs []interface{}) []interface{} {
+	if refs == nil {
+		refs = make([]interface{}, len(m.scans), len(m.scans)+1)
+	}
+	for i, sc := range m.scans {
+		v := sc.fieldOf(obj)
+		switch sc.kind {
+		case scanNull:
+			if refs[i] == nil {
+				refs[i] = reflect.New(reflect.PtrTo(v.Type())).Interface()
+			}
+		case scanJSON:
+			refs[i] = jsonField{v: v}
+		default:
+			refs[i] = v.Addr().Interface()
+		}
+	}
+	return refs
+}
+
+// assign 把scanNull列扫描的结果赋值给obj, NULL时为零值.
+func (m *model) assign(obj reflect.Value, refs []interface{}) {
+	for i, sc := range m.scans {
+		if sc.kind != scanNull {
+			continue
+		}
+		if p := reflect.ValueOf(refs[i]).Elem(); !p.IsNil() {
+			sc.fieldOf(obj).Set(p.Elem())
+		}
+	}
+}
+
+// jsonField db:",json"的字段, 查询时解析json, NULL时为零值.
+type jsonField struct {
+	v reflect.Value
+}
+
+// Scan 实现sql.Scanner.
+func (j jsonField) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.Errorf("unsupported json column type:%T", src)
+	}
+
+	return errors.Trace(json.Unmarshal(b, j.v.Addr().Interface()))
+}
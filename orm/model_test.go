@@ -0,0 +1,181 @@
+package orm
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+type modelUser struct {
+	ID       int64
+	User     string `db:"name,distinct"`
+	Password string `db_const:"md5('x')"`
+	Ctime    string `db_default:"now()"`
+	Skip     string `db_ignore:""`
+	List     struct {
+		ID   int64
+		Name string
+	} `db_table:"one"`
+	Post []struct {
+		ID int64
+	} `db_table:"one2more" db_preload:""`
+	hidden string
+}
+
+func TestModel(t *testing.T) {
+	rt := reflect.TypeOf(modelUser{})
+	m := getModel(rt)
+
+	if getModel(rt) != m {
+		t.Fatalf("model not cached")
+	}
+
+	if m.auto != "id" || m.id != 0 || len(m.scans) != 7 {
+		t.Fatalf("unexpected model:%+v", m)
+	}
+
+	if len(m.relations) != 1 || m.relations[0].kind != "one2more" || !m.relations[0].preload {
+		t.Fatalf("unexpected relations:%+v", m.relations)
+	}
+
+	var keys []string
+	for _, f := range m.inserts {
+		keys = append(keys, f.key+"="+f.val)
+	}
+	if expect := []string{"id=", "name=", "password=md5('x')", "ctime=now()"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("expect:%v, recv:%v", expect, keys)
+	}
+
+	keys = nil
+	for _, f := range m.updates {
+		keys = append(keys, f.key+"="+f.val)
+	}
+	if expect := []string{"id=", "name=", "password=md5('x')", "ctime="}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("expect:%v, recv:%v", expect, keys)
+	}
+
+	s := NewStmt(nil, "user")
+	if sql := s.sqlQuery(rt); sql != "select user.id, distinct user.name, user.password, user.ctime, user.skip, list.id, list.name from user,list where user.list_id = list.id" {
+		t.Fatalf("unexpected sql:%v", sql)
+	}
+}
+
+type nullAttr struct {
+	Color string
+	Size  int
+}
+
+type nullUser struct {
+	ID    int64
+	Name  string
+	Age   int
+	Email *string
+	Phone sql.NullString
+	Attr  nullAttr          `db:",json"`
+	Tags  map[string]string `db:"tags,json"`
+}
+
+func TestModelNull(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("select null_user.id, null_user.name, null_user.age, null_user.email, null_user.phone, null_user.attr, null_user.tags from null_user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age", "email", "phone", "attr", "tags"}).
+			AddRow(1, nil, nil, nil, nil, nil, nil).
+			AddRow(2, "b", 20, "b@x.com", "123", []byte(`{"Color":"red","Size":3}`), `{"k":"v"}`))
+
+	var users []nullUser
+	if err = NewStmt(db, "null_user").Query(&users); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if u := users[0]; u.Name != "" || u.Age != 0 || u.Email != nil || u.Phone.Valid || u.Tags != nil {
+		t.Fatalf("unexpected null user:%+v", u)
+	}
+
+	if u := users[1]; u.Name != "b" || u.Age != 20 || u.Email == nil || *u.Email != "b@x.com" || u.Phone.String != "123" || u.Attr.Color != "red" || u.Tags["k"] != "v" {
+		t.Fatalf("unexpected user:%+v", u)
+	}
+
+	mock.ExpectExec(`insert into null_user \(id, name, age, email, phone, attr, tags\) values \(\?, \?, \?, \?, \?, \?, \?\)`).
+		WithArgs(0, "c", 0, nil, nil, `{"Color":"blue","Size":0}`, nil).WillReturnResult(sqlmock.NewResult(3, 1))
+
+	if _, err = NewStmt(db, "null_user").Insert(nullUser{Name: "c", Attr: nullAttr{Color: "blue"}}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	email := "d@x.com"
+	mock.ExpectExec("update `null_user` set `id`=\\?, `name`=\\?, `age`=\\?, `email`=\\?, `phone`=\\?, `attr`=\\?, `tags`=\\? where id = \\?").
+		WithArgs(0, "d", 1, email, "456", `{"Color":"","Size":0}`, `{"a":"b"}`, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	data := nullUser{Name: "d", Age: 1, Email: &email, Phone: sql.NullString{String: "456", Valid: true}, Tags: map[string]string{"a": "b"}}
+	if _, err = NewStmt(db, "null_user").Where("id = ?", 4).Update(&data); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+type timeUser struct {
+	ID    int64
+	Name  string
+	Ctime time.Time
+	Tags  []string `db:",json"`
+	Info  struct {
+		ID   int64
+		Tags []string `db:",json"`
+	} `db_table:"one"`
+}
+
+func TestModelTime(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectExec(`insert into time_user \(id, name, ctime, tags\) values \(\?, \?, \?, \?\)`).
+		WithArgs(0, "a", now, `["x"]`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if _, err = NewStmt(db, "time_user").Insert(timeUser{Name: "a", Ctime: now, Tags: []string{"x"}}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	mock.ExpectQuery("select time_user.id, time_user.name, time_user.ctime, time_user.tags, info.id, info.tags from time_user,info where time_user.info_id = info.id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "ctime", "tags", "id", "tags"}).
+			AddRow(1, "a", now, `["x"]`, 1, `["y"]`).
+			AddRow(2, nil, nil, nil, 2, nil).
+			AddRow(3, "c", now, nil, 3, nil))
+
+	var users []timeUser
+	if err = NewStmt(db, "time_user").Query(&users); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if u := users[0]; u.Name != "a" || !u.Ctime.Equal(now) || !reflect.DeepEqual(u.Tags, []string{"x"}) || !reflect.DeepEqual(u.Info.Tags, []string{"y"}) {
+		t.Fatalf("unexpected user:%+v", u)
+	}
+
+	//复用扫描指针时NULL列为零值.
+	if u := users[1]; u.Name != "" || !u.Ctime.IsZero() || u.Tags != nil {
+		t.Fatalf("unexpected null user:%+v", u)
+	}
+
+	if u := users[2]; u.Name != "c" || !u.Ctime.Equal(now) {
+		t.Fatalf("unexpected user:%+v", u)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
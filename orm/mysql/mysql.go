@@ -0,0 +1,9 @@
+// Package mysql 注册mysql驱动, 使用orm.DB连接mysql时导入:
+//
+//	import _ "dearcode.net/crab/orm/mysql"
+package mysql
+
+import (
+	//mysql
+	_ "github.com/go-sql-driver/mysql"
+)
@@ -2,10 +2,11 @@ package orm
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 
@@ -14,18 +15,30 @@ import (
 	"dearcode.net/crab/util/str"
 )
 
+const (
+	//defaultBatchSize BatchInsert默认每条insert的行数.
+	defaultBatchSize = 100
+)
+
 // Stmt db stmt.
 type Stmt struct {
-	table  string
-	where  string
-	sort   string
-	order  string
-	group  string
-	offset int
-	limit  int
-	raw    string
-	db     *sql.DB
-	logger *log.Logger
+	table     string
+	where     string
+	sort      string
+	order     string
+	group     string
+	offset    int
+	limit     int
+	raw       string
+	args      []interface{}
+	force     bool
+	timeout   time.Duration
+	batchSize int
+	key       string
+	preloads  map[string]bool
+	db        Executor
+	dialect   Dialect
+	logger    *log.Logger
 }
 
 // IsNotFound error为not found.
@@ -33,30 +46,69 @@ func IsNotFound(err error) bool {
 	return errors.Cause(err) == meta.ErrNotFound
 }
 
-// NewStmt new db stmt.
-func NewStmt(db *sql.DB, table string) *Stmt {
+// NewStmt new db stmt, db可以是*sql.DB, *sql.Tx或*Tx.
+func NewStmt(db Executor, table string) *Stmt {
 	return &Stmt{
-		table: table,
-		db:    db,
+		table:   table,
+		db:      db,
+		dialect: MySQL{},
 	}
 }
 
+// SetDialect 设置数据库类型, 默认MySQL.
+func (s *Stmt) SetDialect(d Dialect) *Stmt {
+	s.dialect = d
+	return s
+}
+
+// Timeout 设置每条sql的超时时间, 0不限制, 在ctx的基础上生效.
+func (s *Stmt) Timeout(d time.Duration) *Stmt {
+	s.timeout = d
+	return s
+}
+
+// context 根据timeout生成执行sql用的ctx.
+func (s *Stmt) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
 // SetLogger 输出log.
 func (s *Stmt) SetLogger(l *log.Logger) *Stmt {
 	s.logger = l
 	return s
 }
 
-// Where 添加查询条件
+// Where 添加查询条件, f中包含?时args作为绑定参数, 切片参数展开为多个?, 可用于in (?),
+// 空切片展开为null, not in (?)也不匹配任何行, 需要时使用WhereCond及NotIn;
+// 否则按fmt.Sprintf格式化(兼容旧用法, 不要传入用户输入).
 func (s *Stmt) Where(f string, args ...interface{}) *Stmt {
-	if len(args) > 0 {
-		s.where = fmt.Sprintf(f, args...)
-	} else {
+	s.args = nil
+	switch {
+	case len(args) == 0:
 		s.where = f
+	case strings.Contains(f, "?"):
+		s.where, s.args = expandArgs(f, args)
+	default:
+		s.where = sprintf(f, args)
 	}
 	return s
 }
 
+// WhereCond 使用条件构造器添加查询条件, 所有值都通过参数绑定.
+func (s *Stmt) WhereCond(c Cond) *Stmt {
+	s.where, s.args = c.SQL()
+	return s
+}
+
+// Force 允许Delete没有where条件, 删除全表.
+func (s *Stmt) Force() *Stmt {
+	s.force = true
+	return s
+}
+
 // Sort 添加sort
 func (s *Stmt) Sort(sort string) *Stmt {
 	s.sort = sort
@@ -87,6 +139,23 @@ func (s *Stmt) Limit(limit int) *Stmt {
 	return s
 }
 
+// BatchSize 设置BatchInsert每条insert的最大行数, 默认100, 注意数据库对绑定参数个数的限制.
+func (s *Stmt) BatchSize(n int) *Stmt {
+	s.batchSize = n
+	return s
+}
+
+// Preload 指定批量加载的关联字段名, 同db_preload标签, 对嵌套的关联同样生效.
+func (s *Stmt) Preload(names ...string) *Stmt {
+	if s.preloads == nil {
+		s.preloads = make(map[string]bool)
+	}
+	for _, n := range names {
+		s.preloads[n] = true
+	}
+	return s
+}
+
 // sqlQueryBuilder build sql query.
 func (s *Stmt) sqlQueryBuilder(result interface{}) (string, error) {
 	rt := reflect.TypeOf(result)
@@ -111,11 +180,12 @@ func (s *Stmt) sqlQueryBuilder(result interface{}) (string, error) {
 	return s.sqlQuery(rt), nil
 }
 
-func (s *Stmt) addWhere(w string) {
+func (s *Stmt) addWhere(w string, args ...interface{}) {
 	if s.where != "" {
 		s.where += " and "
 	}
 	s.where += w
+	s.args = append(s.args, args...)
 }
 
 // sqlOption where, order, limit
@@ -136,11 +206,7 @@ func (s *Stmt) sqlOption(bs *bytes.Buffer) *bytes.Buffer {
 	}
 
 	if s.limit > 0 {
-		bs.WriteString(" limit ")
-		if s.offset > 0 {
-			fmt.Fprintf(bs, "%d,", s.offset)
-		}
-		fmt.Fprintf(bs, "%d", s.limit)
+		bs.WriteString(s.dialect.Limit(s.offset, s.limit))
 	}
 	return bs
 }
@@ -153,60 +219,30 @@ func (s *Stmt) sqlCount() string {
 	s.sqlOption(bs)
 
 	sql := bs.String()
-	s.logger.Debugf("sql:%v", sql)
+	s.logger.Debugf("sql:%v, args:%v", sql, s.args)
 	return sql
 }
 
 // sqlColumn 生成查询需要的列，目前只是内部用.
-func (s *Stmt) sqlColumn(rt reflect.Type, table string) string {
+func (s *Stmt) sqlColumn(m *model, table string) string {
 	bs := bytes.NewBufferString("")
 
-	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if f.PkgPath != "" && !f.Anonymous { // unexported
+	for _, c := range m.columns {
+		if c.one != nil {
+			s.table += "," + c.one.table
+			bs.WriteString(s.sqlColumn(c.one.model, c.one.table))
+			s.addWhere(fmt.Sprintf("%s.%s = %s.id", table, c.one.relField, c.one.table))
 			continue
 		}
-		switch f.Type.Kind() {
-		case reflect.Struct:
-			if f.Tag.Get("db_table") == "one" {
-				s.table += ","
-				field := str.FieldEscape(f.Name)
-				s.table += field
-				bs.WriteString(s.sqlColumn(f.Type, str.FieldEscape(f.Name)))
-
-				if rf := f.Tag.Get("db_relation_field"); rf != "" {
-					s.addWhere(fmt.Sprintf("%s.%s = %s.id", table, rf, field))
-				} else {
-					s.addWhere(fmt.Sprintf("%s.%s_id = %s.id", table, field, field))
-				}
-
-				continue
-			}
-		case reflect.Slice:
-			continue
-		}
-
-		attr := ""
-		name := f.Tag.Get("db")
-
-		if kv := strings.Split(name, ","); len(kv) == 2 {
-			name = kv[0]
-			attr = kv[1]
-		}
-
-		if name == "" {
-			name = str.FieldEscape(f.Name)
-		}
 
-		switch attr {
-		case "distinct":
+		if c.distinct {
 			bs.WriteString("distinct ")
 		}
 
-		if !strings.Contains(name, ".") && !strings.Contains(name, "(") {
+		if c.qualify {
 			fmt.Fprintf(bs, "%s.", table)
 		}
-		fmt.Fprintf(bs, "%s, ", name)
+		fmt.Fprintf(bs, "%s, ", c.name)
 	}
 
 	return bs.String()
@@ -220,15 +256,18 @@ func (s *Stmt) sqlQuery(rt reflect.Type) string {
 
 	bs := bytes.NewBufferString("select ")
 	firstTable := strings.Split(s.table, ",")[0]
-	bs.WriteString(s.sqlColumn(rt, firstTable))
+	bs.WriteString(s.sqlColumn(getModel(rt), firstTable))
 	bs.Truncate(bs.Len() - 2)
+	if s.key != "" {
+		bs.WriteString(", " + s.key)
+	}
 	bs.WriteString(" from ")
 	bs.WriteString(s.table)
 
 	s.sqlOption(bs)
 	sql := bs.String()
 
-	s.logger.Debugf("sql:%v", sql)
+	s.logger.Debugf("sql:%v, args:%v", sql, s.args)
 
 	return sql
 }
@@ -244,7 +283,7 @@ func (s *Stmt) firstTable() string {
 func (s *Stmt) addRelation(t1, t2 string, id interface{}) *Stmt {
 	t1 = str.FieldEscape(t1)
 	t2 = str.FieldEscape(t2)
-	s.addWhere(fmt.Sprintf("id in (select %s_id from %s_%s_relation where %s_id=%d)", t1, t2, t1, t2, id))
+	s.addWhere(fmt.Sprintf("id in (select %s_id from %s_%s_relation where %s_id=?)", t1, t2, t1, t2), id)
 	return s
 }
 
@@ -252,12 +291,17 @@ func (s *Stmt) addRelation(t1, t2 string, id interface{}) *Stmt {
 func (s *Stmt) addOne2More(t1, t2 string, id interface{}) *Stmt {
 	t1 = str.FieldEscape(t1)
 	t2 = str.FieldEscape(t2)
-	s.addWhere(fmt.Sprintf("%s.%s_id=%d", t1, t2, id))
+	s.addWhere(fmt.Sprintf("%s.%s_id=?", t1, t2), id)
 	return s
 }
 
 // Query 根据传入的result结构，生成查询sql，并返回执行结果， result 必需是一个指向切片的指针.
 func (s *Stmt) Query(result interface{}) error {
+	return s.QueryContext(context.Background(), result)
+}
+
+// QueryContext 同Query, ctx取消或超时时中止查询.
+func (s *Stmt) QueryContext(ctx context.Context, result interface{}) error {
 	if result == nil {
 		return meta.ErrArgIsNil
 	}
@@ -284,110 +328,202 @@ func (s *Stmt) Query(result interface{}) error {
 
 	sql := s.sqlQuery(rt)
 
-	rows, err := s.db.Query(sql)
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	objs, _, err := s.queryObjs(ctx, rt, sql)
 	if err != nil {
-		return errors.Annotatef(err, sql)
+		return errors.Trace(err)
+	}
+
+	if len(objs) == 0 {
+		return errors.Trace(meta.ErrNotFound)
 	}
-	defer rows.Close()
 
 	rv := reflect.ValueOf(result).Elem()
+	if rv.Kind() == reflect.Struct {
+		rv.Set(objs[0])
+		s.logger.Debugf("result %#v", result)
+		return nil
+	}
 
-	for rows.Next() {
-		var refs []interface{}
-		obj := reflect.New(rt).Elem()
-		var idx int
+	for _, obj := range objs {
+		rv = reflect.Append(rv, obj)
+	}
 
-		for i := 0; i < obj.NumField(); i++ {
-			f := rt.Field(i)
-			if f.PkgPath != "" && !f.Anonymous { // unexported
-				continue
-			}
+	reflect.ValueOf(result).Elem().Set(rv)
+	s.logger.Debugf("result %v", result)
 
-			if f.Name == "ID" {
-				idx = len(refs)
-			}
+	return nil
+}
 
-			switch f.Type.Kind() {
-			case reflect.Struct:
-				if f.Tag.Get("db_table") == "one" {
-					//一对一，这里代码重复是为了减少交互.
-					for j := 0; j < obj.Field(i).NumField(); j++ {
-						sf := rt.Field(i).Type.Field(j)
-						if sf.PkgPath != "" && !sf.Anonymous { // unexported
-							continue
-						}
-						if sf.Type.Kind() == reflect.Slice {
-							continue
-						}
-
-						refs = append(refs, obj.Field(i).Field(j).Addr().Interface())
-					}
-					continue
-				}
-			case reflect.Slice:
-				continue
-			}
+// queryObjs 执行查询, 每行生成一个rt类型的对象并填充一对多关联.
+// s.key不为空时, 最后一列为关联的父id, 通过keys返回.
+func (s *Stmt) queryObjs(ctx context.Context, rt reflect.Type, sql string) (objs []reflect.Value, keys []string, err error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(sql), s.args...)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, sql)
+	}
+	defer rows.Close()
+
+	m := getModel(rt)
+	var ids []interface{}
+
+	var refs []interface{}
+	var key interface{}
 
-			refs = append(refs, obj.Field(i).Addr().Interface())
+	for rows.Next() {
+		obj := reflect.New(rt).Elem()
+		first := refs == nil
+		refs = m.scanRefs(obj, refs)
+		if first && s.key != "" {
+			refs = append(refs, &key)
 		}
 
 		if err = rows.Scan(refs...); err != nil {
-			return errors.Trace(err)
+			return nil, nil, errors.Trace(err)
 		}
+		m.assign(obj, refs)
 
-		//一对多
-		for i := 0; i < obj.NumField(); i++ {
-			f := rt.Field(i)
-			if f.PkgPath != "" && !f.Anonymous { // unexported
-				continue
-			}
-			if f.Type.Kind() != reflect.Slice {
-				continue
+		objs = append(objs, obj)
+		if len(m.scans) > 0 {
+			ids = append(ids, m.scans[m.id].fieldOf(obj).Interface())
+		}
+		if s.key != "" {
+			keys = append(keys, keyString(key))
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	//关联查询前先关闭rows, 事务中同一连接不能同时执行多个查询.
+	rows.Close()
+
+	if err = s.loadRelations(ctx, m, objs, ids); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	return objs, keys, nil
+}
+
+// loadRelations 填充db_table为more及one2more的切片字段, 开启预加载的批量查询, 否则每行查询一次.
+func (s *Stmt) loadRelations(ctx context.Context, m *model, objs []reflect.Value, ids []interface{}) error {
+	if len(objs) == 0 || len(ids) != len(objs) {
+		return nil
+	}
+
+	for _, r := range m.relations {
+		if r.preload || s.preloads[r.name] {
+			if err := s.preload(ctx, r, objs, ids); err != nil {
+				return errors.Trace(err)
 			}
+			continue
+		}
 
-			lr := obj.Field(i).Addr().Interface()
-			id := reflect.ValueOf(refs[idx]).Elem().Interface()
+		for j, obj := range objs {
+			//填充一对多结果，每次去查询
+			cs := s.child(r.name)
+			if r.kind == "more" {
+				cs.addRelation(r.name, s.firstTable(), ids[j])
+			} else {
+				cs.addOne2More(r.name, s.firstTable(), ids[j])
+			}
 
-			switch f.Tag.Get("db_table") {
-			case "more":
-				//填充一对多结果，每次去查询
-				if err = NewStmt(s.db, str.FieldEscape(f.Name)).addRelation(f.Name, s.firstTable(), id).Query(lr); err != nil {
-					if errors.Cause(err) != meta.ErrNotFound {
-						return errors.Trace(err)
-					}
-				}
-			case "one2more":
-				//填充一对多结果，每次去查询
-				if err = NewStmt(s.db, str.FieldEscape(f.Name)).addOne2More(f.Name, s.firstTable(), id).Query(lr); err != nil {
-					if errors.Cause(err) != meta.ErrNotFound {
-						return errors.Trace(err)
-					}
+			if err := cs.QueryContext(ctx, obj.Field(r.index).Addr().Interface()); err != nil {
+				if errors.Cause(err) != meta.ErrNotFound {
+					return errors.Trace(err)
 				}
 			}
 		}
+	}
 
-		if rv.Kind() == reflect.Struct {
-			reflect.ValueOf(result).Elem().Set(reflect.ValueOf(obj.Interface()))
-			s.logger.Debugf("result %#v", result)
-			return nil
-		}
+	return nil
+}
 
-		rv = reflect.Append(rv, obj)
+// child 生成查询关联表的Stmt.
+func (s *Stmt) child(name string) *Stmt {
+	cs := NewStmt(s.db, str.FieldEscape(name)).SetDialect(s.dialect).SetLogger(s.logger)
+	cs.preloads = s.preloads
+	return cs
+}
+
+// preload 用一条in查询加载所有行的关联数据, 再按父id填充到objs.
+func (s *Stmt) preload(ctx context.Context, r relation, objs []reflect.Value, ids []interface{}) error {
+	t1 := str.FieldEscape(r.name)
+	t2 := str.FieldEscape(s.firstTable())
+
+	cs := s.child(r.name)
+	if r.kind == "more" {
+		rel := fmt.Sprintf("%s_%s_relation", t2, t1)
+		cs.table += "," + rel
+		cs.key = fmt.Sprintf("%s.%s_id", rel, t2)
+		cs.addWhere(fmt.Sprintf("%s.id = %s.%s_id", t1, rel, t1))
+	} else {
+		cs.key = fmt.Sprintf("%s.%s_id", t1, t2)
 	}
+	w, args := In(cs.key, uniqueKeys(ids)).SQL()
+	cs.addWhere(w, args...)
 
-	if rv.Kind() == reflect.Struct || rv.Len() == 0 {
-		return errors.Trace(meta.ErrNotFound)
+	ct := r.typ.Elem()
+	children, keys, err := cs.queryObjs(ctx, ct, cs.sqlQuery(ct))
+	if err != nil {
+		return errors.Trace(err)
 	}
 
-	reflect.ValueOf(result).Elem().Set(reflect.ValueOf(rv.Interface()))
-	s.logger.Debugf("result %v", result)
+	groups := make(map[string]reflect.Value)
+	for i, child := range children {
+		g, ok := groups[keys[i]]
+		if !ok {
+			g = reflect.MakeSlice(r.typ, 0, 1)
+		}
+		groups[keys[i]] = reflect.Append(g, child)
+	}
+
+	for i, obj := range objs {
+		if g, ok := groups[keyString(ids[i])]; ok {
+			obj.Field(r.index).Set(g)
+		}
+	}
 
 	return nil
 }
 
+// uniqueKeys 父id去重.
+func uniqueKeys(ids []interface{}) []interface{} {
+	var result []interface{}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		k := keyString(id)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// keyString 关联id转为字符串, 用于匹配驱动返回的不同类型.
+func keyString(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
 // Count 查询总数.
 func (s *Stmt) Count() (int64, error) {
-	rows, err := s.db.Query(s.sqlCount())
+	return s.CountContext(context.Background())
+}
+
+// CountContext 同Count, ctx取消或超时时中止查询.
+func (s *Stmt) CountContext(ctx context.Context) (int64, error) {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(s.sqlCount()), s.args...)
 	if err != nil {
 		return 0, errors.Trace(err)
 	}
@@ -404,107 +540,96 @@ func (s *Stmt) Count() (int64, error) {
 }
 
 // sqlInsert 添加数据
-func (s *Stmt) sqlInsert(rt reflect.Type, rv reflect.Value) (sql string, refs []interface{}) {
+func (s *Stmt) sqlInsert(rt reflect.Type, rv reflect.Value) (sql string, refs []interface{}, err error) {
+	return s.sqlBatchInsert(rt, []reflect.Value{rv})
+}
+
+// sqlBatchInsert 生成多行insert, rows都是rt类型的结构体.
+func (s *Stmt) sqlBatchInsert(rt reflect.Type, rows []reflect.Value) (sql string, refs []interface{}, err error) {
+	fields := getModel(rt).inserts
+
 	bs := bytes.NewBufferString("insert into ")
 	bs.WriteString(s.table)
 	bs.WriteString(" (")
 
-	dbs := bytes.NewBufferString(") values (")
-
-	for i := 0; i < rt.NumField(); i++ {
-		key, val, ok := s.sqlStructField(rt.Field(i), false)
-		if !ok {
-			continue
+	for i, f := range fields {
+		if i > 0 {
+			bs.WriteString(", ")
 		}
-
-		bs.WriteString(key)
-		bs.WriteString(", ")
-
-		if val != "" {
-			dbs.WriteString(val)
-			dbs.WriteString(", ")
-			continue
-		}
-
-		dbs.WriteString("?, ")
-		refs = append(refs, rv.Field(i).Interface())
+		bs.WriteString(f.key)
 	}
 
-	bs.Truncate(bs.Len() - 2)
-	dbs.Truncate(dbs.Len() - 2)
-
-	bs.WriteString(dbs.String())
+	bs.WriteString(") values ")
 
-	bs.WriteString(") ")
-	sql = bs.String()
-	s.logger.Debugf("sql:%v", sql)
-	return
-}
-
-// sqlStructField 解析结构体中的字段，根据default及db值内容生成对应key ,value.
-func (s *Stmt) sqlStructField(f reflect.StructField, isUpdate bool) (key string, val string, ok bool) {
-	if f.PkgPath != "" && !f.Anonymous { // unexported
-		return
-	}
-
-	switch f.Type.Kind() {
-	case reflect.Struct, reflect.Slice, reflect.Ptr:
-		return
-	}
+	for j, rv := range rows {
+		if j > 0 {
+			bs.WriteString(", ")
+		}
+		bs.WriteString("(")
 
-	if _, ignore := f.Tag.Lookup("db_auto"); ignore {
-		return
-	}
+		for i, f := range fields {
+			if i > 0 {
+				bs.WriteString(", ")
+			}
 
-	if _, ignore := f.Tag.Lookup("db_ignore"); ignore {
-		return
-	}
+			if f.val != "" {
+				bs.WriteString(f.val)
+				continue
+			}
 
-	if key, ok = f.Tag.Lookup("db"); !ok {
-		key = str.FieldEscape(f.Name)
-	}
+			v, err := f.value(rv)
+			if err != nil {
+				return "", nil, errors.Trace(err)
+			}
 
-	//insert 解析default
-	if !isUpdate {
-		if val, ok = f.Tag.Lookup("db_default"); ok {
-			return
+			bs.WriteString("?")
+			refs = append(refs, v)
 		}
-	}
 
-	if val, ok = f.Tag.Lookup("db_const"); ok {
-		return
+		bs.WriteString(")")
 	}
 
-	return key, "", true
+	bs.WriteString(" ")
+	sql = bs.String()
+	s.logger.Debugf("sql:%v", sql)
+	return
 }
 
 // sqlUpdate 根据条件及结构生成update sql
-func (s *Stmt) sqlUpdate(rt reflect.Type, rv reflect.Value) (sql string, refs []interface{}) {
-	bs := bytes.NewBufferString(fmt.Sprintf("update `%s` set ", s.table))
+func (s *Stmt) sqlUpdate(rt reflect.Type, rv reflect.Value) (sql string, refs []interface{}, err error) {
+	bs := bytes.NewBufferString(fmt.Sprintf("update %s set ", s.dialect.Quote(s.table)))
 
-	for i := 0; i < rt.NumField(); i++ {
-		key, val, ok := s.sqlStructField(rt.Field(i), true)
-		if !ok {
+	for _, f := range getModel(rt).updates {
+		if f.val != "" {
+			fmt.Fprintf(bs, "%s=%s, ", s.dialect.Quote(f.key), f.val)
 			continue
 		}
 
-		if val != "" {
-			fmt.Fprintf(bs, "`%s`=%s, ", key, val)
-			continue
+		v, err := f.value(rv)
+		if err != nil {
+			return "", nil, errors.Trace(err)
 		}
 
-		fmt.Fprintf(bs, "`%s`=?, ", key)
+		fmt.Fprintf(bs, "%s=?, ", s.dialect.Quote(f.key))
 
-		refs = append(refs, rv.Field(i).Interface())
+		refs = append(refs, v)
 	}
 
 	bs.Truncate(bs.Len() - 2)
 
-	return s.sqlOption(bs).String(), refs
+	//where中的绑定参数在set之后.
+	refs = append(refs, s.args...)
+
+	return s.sqlOption(bs).String(), refs, nil
 }
 
-// Update sql update db.
+// Update sql update db.
 func (s *Stmt) Update(data interface{}) (int64, error) {
+	return s.UpdateContext(context.Background(), data)
+}
+
+// UpdateContext 同Update, ctx取消或超时时中止执行.
+func (s *Stmt) UpdateContext(ctx context.Context, data interface{}) (int64, error) {
 	if data == nil {
 		return 0, errors.Trace(meta.ErrArgIsNil)
 	}
@@ -520,9 +645,16 @@ func (s *Stmt) Update(data interface{}) (int64, error) {
 		return 0, errors.Trace(meta.ErrFieldNotFound)
 	}
 
-	sql, refs := s.sqlUpdate(rt, rv)
+	sql, refs, err := s.sqlUpdate(rt, rv)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
 	s.logger.Debugf("sql:%v, vals:%#v", sql, refs)
-	r, err := s.db.Exec(sql, refs...)
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	r, err := s.db.ExecContext(ctx, s.dialect.Rebind(sql), refs...)
 	if err != nil {
 		return 0, errors.Trace(err)
 	}
@@ -531,6 +663,11 @@ func (s *Stmt) Update(data interface{}) (int64, error) {
 
 // Insert sql update db.
 func (s *Stmt) Insert(data interface{}) (int64, error) {
+	return s.InsertContext(context.Background(), data)
+}
+
+// InsertContext 同Insert, ctx取消或超时时中止执行.
+func (s *Stmt) InsertContext(ctx context.Context, data interface{}) (int64, error) {
 	if data == nil {
 		return 0, errors.Trace(meta.ErrArgIsNil)
 	}
@@ -546,78 +683,338 @@ func (s *Stmt) Insert(data interface{}) (int64, error) {
 		return 0, errors.Trace(meta.ErrFieldNotFound)
 	}
 
-	sql, refs := s.sqlInsert(rt, rv)
-	r, err := s.db.Exec(sql, refs...)
+	sql, refs, err := s.sqlInsert(rt, rv)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	return s.insert(ctx, s.db, rt, sql, refs)
+}
+
+// insert 执行insert并返回自增id, 不支持LastInsertId的数据库(Returning不为空)使用returning, 没有自增列时返回0.
+func (s *Stmt) insert(ctx context.Context, ex Executor, rt reflect.Type, sql string, refs []interface{}) (int64, error) {
+	col := getModel(rt).auto
+	ret := s.dialect.Returning("id")
+	if col != "" {
+		ret = s.dialect.Returning(col)
+	}
+
+	if ret != "" && col != "" {
+		var id int64
+		if err := ex.QueryRowContext(ctx, s.dialect.Rebind(sql+ret), refs...).Scan(&id); err != nil {
+			return 0, errors.Trace(err)
+		}
+		return id, nil
+	}
+
+	r, err := ex.ExecContext(ctx, s.dialect.Rebind(sql), refs...)
 	if err != nil {
 		return 0, errors.Trace(err)
 	}
 
-	return r.LastInsertId()
+	if ret != "" {
+		return 0, nil
+	}
+
+	id, err := r.LastInsertId()
+	return id, errors.Trace(err)
+}
+
+// BatchInsert 批量插入, data为结构体或结构体指针的切片, 按BatchSize分批生成多行insert, 在同一个事务中执行, 返回每行的自增id.
+// 支持returning的数据库使用多行insert, mysql默认逐行插入, 见MySQL.ConsecutiveIDs.
+func (s *Stmt) BatchInsert(data interface{}) ([]int64, error) {
+	return s.BatchInsertContext(context.Background(), data)
 }
 
-// BatchInsert 数组插入
-func (s *Stmt) BatchInsert(data []interface{}) ([]int64, error) {
-	fmt.Printf("data:%#v\n", data)
-	if len(data) == 0 {
+// BatchInsertContext 同BatchInsert, ctx取消或超时时中止并回滚.
+func (s *Stmt) BatchInsertContext(ctx context.Context, data interface{}) ([]int64, error) {
+	if data == nil {
 		return nil, errors.Trace(meta.ErrArgIsNil)
 	}
 
-	txn, err := s.db.Begin()
+	list := reflect.ValueOf(data)
+	if list.Kind() != reflect.Slice {
+		return nil, errors.Errorf("data type must be slice, recv:%v", list.Kind())
+	}
+
+	if list.Len() == 0 {
+		return nil, errors.Trace(meta.ErrArgIsNil)
+	}
+
+	size := s.batchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	var ids []int64
+
+	err := WithTx(ctx, s.db, func(tx *Tx) error {
+		var rt reflect.Type
+		var rows []reflect.Value
+
+		flush := func() error {
+			if len(rows) == 0 {
+				return nil
+			}
+			rs, err := s.batchInsert(ctx, tx, rt, rows)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			ids = append(ids, rs...)
+			rows = rows[:0]
+			return nil
+		}
+
+		for i := 0; i < list.Len(); i++ {
+			rv := list.Index(i)
+			for rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr {
+				if rv.IsNil() {
+					return errors.Annotatef(meta.ErrArgIsNil, "index:%v", i)
+				}
+				rv = rv.Elem()
+			}
+
+			if rv.Kind() != reflect.Struct || rv.NumField() == 0 {
+				s.logger.Errorf("kind:%v, type:%v", rv.Kind(), rv.Type())
+				return errors.Trace(meta.ErrFieldNotFound)
+			}
+
+			//类型不同的不能在同一条insert中.
+			if rv.Type() != rt || len(rows) == size {
+				if err := flush(); err != nil {
+					return err
+				}
+				rt = rv.Type()
+			}
+			rows = append(rows, rv)
+		}
+
+		return flush()
+	})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	defer func() {
-		if err != nil {
-			txn.Rollback()
-			return
+	return ids, nil
+}
+
+// batchInsert 执行一条多行insert, 返回每行的id, 不能计算多行id的数据库逐行插入.
+func (s *Stmt) batchInsert(ctx context.Context, ex Executor, rt reflect.Type, rows []reflect.Value) ([]int64, error) {
+	col := getModel(rt).auto
+	ret := s.dialect.Returning("id")
+	if col != "" {
+		ret = s.dialect.Returning(col)
+	}
+
+	bi, ok := s.dialect.(batchIDer)
+	if len(rows) == 1 || (ret == "" && (!ok || !bi.BatchIDsEnabled())) {
+		var ids []int64
+		for _, rv := range rows {
+			sql, refs, err := s.sqlInsert(rt, rv)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			id, err := s.insert(ctx, ex, rt, sql, refs)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			ids = append(ids, id)
 		}
-		txn.Commit()
-	}()
+		return ids, nil
+	}
 
-	var ir sql.Result
-	var ids []int64
+	sql, refs, err := s.sqlBatchInsert(rt, rows)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
-	fmt.Printf("data:%#v\n", data)
-	for _, d := range data {
-		rt := reflect.TypeOf(d)
-		rv := reflect.ValueOf(d)
+	if ret != "" && col != "" {
+		rs, err := ex.QueryContext(ctx, s.dialect.Rebind(sql+ret), refs...)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer rs.Close()
 
-		if rt.Kind() == reflect.Ptr {
-			rt = rt.Elem()
-			rv = rv.Elem()
+		var ids []int64
+		for rs.Next() {
+			var id int64
+			if err = rs.Scan(&id); err != nil {
+				return nil, errors.Trace(err)
+			}
+			ids = append(ids, id)
+		}
+		if err = rs.Err(); err != nil {
+			return nil, errors.Trace(err)
 		}
+		if len(ids) != len(rows) {
+			return nil, errors.Errorf("returning ids:%v, rows:%v", len(ids), len(rows))
+		}
+		return ids, nil
+	}
 
-		if rt.Kind() != reflect.Struct || rt.NumField() == 0 {
-			s.logger.Errorf("kind:%v, type:%v", rt.Kind(), rt)
-			return nil, errors.Trace(meta.ErrFieldNotFound)
+	r, err := ex.ExecContext(ctx, s.dialect.Rebind(sql), refs...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if ret != "" {
+		return make([]int64, len(rows)), nil
+	}
+
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return bi.BatchIDs(id, len(rows)), nil
+}
+
+// sqlDelete 根据条件生成delete sql.
+func (s *Stmt) sqlDelete() (string, error) {
+	if s.where == "" && !s.force {
+		return "", errors.Trace(meta.ErrNoCondition)
+	}
+
+	bs := bytes.NewBufferString("delete from ")
+	bs.WriteString(s.table)
+
+	if s.where != "" {
+		fmt.Fprintf(bs, " where %s", s.where)
+	}
+
+	if s.limit > 0 {
+		dl, ok := s.dialect.(deleteLimiter)
+		if !ok {
+			return "", errors.Errorf("%v not support delete limit", s.dialect.Name())
 		}
+		bs.WriteString(dl.DeleteLimit(s.limit))
+	}
 
-		stmt, refs := s.sqlInsert(rt, rv)
+	return bs.String(), nil
+}
 
-		if ir, err = txn.Exec(stmt, refs...); err != nil {
-			return nil, errors.Trace(err)
+// Delete 按Where条件删除, 没有条件时返回meta.ErrNoCondition, 需要删除全表时先调用Force.
+func (s *Stmt) Delete() (int64, error) {
+	return s.DeleteContext(context.Background())
+}
+
+// DeleteContext 同Delete, ctx取消或超时时中止执行.
+func (s *Stmt) DeleteContext(ctx context.Context) (int64, error) {
+	sql, err := s.sqlDelete()
+	if err != nil {
+		return 0, err
+	}
+
+	s.logger.Debugf("sql:%v, args:%v", sql, s.args)
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	r, err := s.db.ExecContext(ctx, s.dialect.Rebind(sql), s.args...)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return r.RowsAffected()
+}
+
+// sqlUpsert 生成insert语句, 冲突时更新除conflictKeys外的字段.
+func (s *Stmt) sqlUpsert(rt reflect.Type, rv reflect.Value, conflictKeys []string) (string, []interface{}, error) {
+	sql, refs, err := s.sqlInsert(rt, rv)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+
+	keys := make(map[string]bool)
+	for _, k := range conflictKeys {
+		keys[k] = true
+	}
+
+	//db_default只在插入时使用, 如创建时间, 冲突时不更新.
+	var update []string
+	for _, f := range getModel(rt).inserts {
+		if !f.def && !keys[f.key] {
+			update = append(update, f.key)
 		}
+	}
+
+	up := s.dialect.Upsert(conflictKeys, update)
+	if up == "" {
+		return "", nil, errors.Errorf("%v upsert need conflict keys", s.dialect.Name())
+	}
 
-		id, _ := ir.LastInsertId()
+	return strings.TrimSpace(sql) + up, refs, nil
+}
 
-		ids = append(ids, id)
+// Upsert 插入数据, conflictKeys冲突时更新其它字段, 返回影响的行数.
+// mysql根据表的唯一索引判断冲突, conflictKeys可以为空, 只用于排除不需要更新的字段, 其它数据库必须是唯一索引的列.
+func (s *Stmt) Upsert(data interface{}, conflictKeys ...string) (int64, error) {
+	return s.UpsertContext(context.Background(), data, conflictKeys...)
+}
+
+// UpsertContext 同Upsert, ctx取消或超时时中止执行.
+func (s *Stmt) UpsertContext(ctx context.Context, data interface{}, conflictKeys ...string) (int64, error) {
+	if data == nil {
+		return 0, errors.Trace(meta.ErrArgIsNil)
 	}
 
-	return ids, nil
+	rt := reflect.TypeOf(data)
+	rv := reflect.ValueOf(data)
+
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+		rv = rv.Elem()
+	}
+
+	if rt.Kind() != reflect.Struct || rt.NumField() == 0 {
+		return 0, errors.Trace(meta.ErrFieldNotFound)
+	}
+
+	sql, refs, err := s.sqlUpsert(rt, rv, conflictKeys)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	s.logger.Debugf("sql:%v, vals:%#v", sql, refs)
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	r, err := s.db.ExecContext(ctx, s.dialect.Rebind(sql), refs...)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return r.RowsAffected()
 }
 
 // Exec 保留的原始执行接口.
 func (s *Stmt) Exec(query string, args ...interface{}) (int64, error) {
-	rs, err := s.db.Exec(query, args...)
+	return s.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext 同Exec, ctx取消或超时时中止执行.
+func (s *Stmt) ExecContext(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	rs, err := s.db.ExecContext(ctx, s.dialect.Rebind(query), args...)
 	if err != nil {
 		return -1, errors.Trace(err)
 	}
 	return rs.RowsAffected()
 }
 
-// Raw 原始sql.
+// Raw 原始sql, query中包含?时args作为绑定参数, 否则按fmt.Sprintf格式化.
 func (s *Stmt) Raw(query string, args ...interface{}) *Stmt {
-	s.raw = fmt.Sprintf(query, args...)
+	s.args = nil
+	if len(args) > 0 && strings.Contains(query, "?") {
+		s.raw, s.args = expandArgs(query, args)
+		return s
+	}
+	s.raw = sprintf(query, args)
 	return s
 }
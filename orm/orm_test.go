@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 
 	"dearcode.net/crab/log"
+	"dearcode.net/crab/meta"
 )
 
 func TestORMStructDistinct(t *testing.T) {
@@ -292,3 +294,302 @@ func TestORMSubStruct(t *testing.T) {
 
 	t.Logf("sql:%+v", str)
 }
+
+func TestORMWhereBind(t *testing.T) {
+	result := []struct {
+		ID   int64
+		User string
+	}{}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	name := "x' or '1'='1"
+	mock.ExpectQuery(`select userinfo.id, userinfo.user from userinfo where user = \? and id in \(\?, \?\)`).
+		WithArgs(name, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user"}).AddRow(1, name))
+	mock.ExpectQuery(`select count\(\*\) from userinfo where \(user = \?\) and \(id > \?\)`).
+		WithArgs(name, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("update `userinfo` set `user`=\\? where id = \\?").
+		WithArgs("new", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err = NewStmt(db, "userinfo").Where("user = ? and id in (?)", name, []int{1, 2}).Query(&result); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	n, err := NewStmt(db, "userinfo").WhereCond(And(Eq("user", name), Gt("id", 0))).Count()
+	if err != nil || n != 1 {
+		t.Fatalf("unexpected count:%v, err:%v", n, err)
+	}
+
+	data := struct{ User string }{User: "new"}
+	if _, err = NewStmt(db, "userinfo").Where("id = ?", 1).Update(&data); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//Update没有条件时更新全表.
+	mock.ExpectExec("update `userinfo` set `user`=\\?$").WithArgs("new").WillReturnResult(sqlmock.NewResult(0, 3))
+	if n, err = NewStmt(db, "userinfo").Update(&data); err != nil || n != 3 {
+		t.Fatalf("unexpected update:%v, err:%v", n, err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestORMDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`delete from userinfo where id = \? limit 1`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`delete from userinfo$`).WillReturnResult(sqlmock.NewResult(0, 5))
+
+	if _, err = NewStmt(db, "userinfo").Delete(); err == nil || err.Error() != meta.ErrNoCondition.Error() {
+		t.Fatalf("expect ErrNoCondition, recv:%v", err)
+	}
+
+	if n, err := NewStmt(db, "userinfo").Where("id = ?", 3).Limit(1).Delete(); err != nil || n != 1 {
+		t.Fatalf("unexpected delete:%v, err:%v", n, err)
+	}
+
+	if n, err := NewStmt(db, "userinfo").Force().Delete(); err != nil || n != 5 {
+		t.Fatalf("unexpected delete:%v, err:%v", n, err)
+	}
+
+	if _, err = NewStmt(db, "userinfo").SetDialect(PostgreSQL{}).Where("id = ?", 3).Limit(1).Delete(); err == nil {
+		t.Fatalf("expect postgres delete limit error")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestORMUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	data := struct {
+		ID    int64 `db_auto:""`
+		Email string
+		Name  string
+		Ctime string `db_default:"now()"`
+		Mtime string `db_const:"now()"`
+	}{Email: "a@crab", Name: "crab"}
+
+	mock.ExpectExec("insert into userinfo \\(email, name, ctime, mtime\\) values \\(\\?, \\?, now\\(\\), now\\(\\)\\) on duplicate key update `name`=values\\(`name`\\), `mtime`=values\\(`mtime`\\)$").
+		WithArgs("a@crab", "crab").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec(`insert into userinfo \(email, name, ctime, mtime\) values \(\$1, \$2, now\(\), now\(\)\) on conflict \("email"\) do update set "name"=excluded."name"`).
+		WithArgs("a@crab", "crab").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if n, err := NewStmt(db, "userinfo").Upsert(&data, "email"); err != nil || n != 2 {
+		t.Fatalf("unexpected upsert:%v, err:%v", n, err)
+	}
+
+	if _, err = NewStmt(db, "userinfo").SetDialect(PostgreSQL{}).Upsert(&data, "email"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	//mysql可以不指定conflictKeys.
+	mock.ExpectExec("insert into userinfo \\(email, name, ctime, mtime\\) values \\(\\?, \\?, now\\(\\), now\\(\\)\\) on duplicate key update `email`=values\\(`email`\\), `name`=values\\(`name`\\), `mtime`=values\\(`mtime`\\)$").
+		WithArgs("a@crab", "crab").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if _, err = NewStmt(db, "userinfo").Upsert(&data); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err = NewStmt(db, "userinfo").SetDialect(PostgreSQL{}).Upsert(&data); err == nil {
+		t.Fatalf("expect postgres conflict keys required")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestORMContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("update `userinfo` set").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("select count").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	data := struct {
+		User string
+	}{User: "a"}
+
+	begin := time.Now()
+	if _, err = NewStmt(db, "userinfo").Timeout(10*time.Millisecond).Where("id = ?", 1).Update(&data); err == nil {
+		t.Fatalf("expect update timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err = NewStmt(db, "userinfo").CountContext(ctx); err == nil {
+		t.Fatalf("expect count canceled")
+	}
+
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Fatalf("sql not aborted, duration:%v", d)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+type preloadTag struct {
+	ID   int64
+	Name string
+}
+
+type preloadPost struct {
+	ID    int64
+	Title string
+	Tag   []preloadTag `db_table:"more"`
+}
+
+type preloadUser struct {
+	ID   int64
+	Name string
+	Post []preloadPost `db_table:"one2more" db_preload:""`
+}
+
+func TestORMPreload(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`select user.id, user.name from user`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b").AddRow(3, "c"))
+	mock.ExpectQuery(`select post.id, post.title, post.user_id from post where post.user_id in \(\?, \?, \?\)`).WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "user_id"}).AddRow(10, "p10", 1).AddRow(11, "p11", 1).AddRow(20, "p20", 2))
+	mock.ExpectQuery(`select tag.id, tag.name, post_tag_relation.post_id from tag,post_tag_relation where tag.id = post_tag_relation.tag_id and post_tag_relation.post_id in \(\?, \?, \?\)`).WithArgs(10, 11, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "post_id"}).AddRow(100, "go", []byte("10")).AddRow(101, "db", []byte("20")).AddRow(100, "go", []byte("20")))
+
+	var users []preloadUser
+	if err = NewStmt(db, "user").Preload("Tag").Query(&users); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(users) != 3 || len(users[0].Post) != 2 || len(users[1].Post) != 1 || len(users[2].Post) != 0 {
+		t.Fatalf("unexpected users:%+v", users)
+	}
+	if len(users[0].Post[0].Tag) != 1 || len(users[0].Post[1].Tag) != 0 || len(users[1].Post[0].Tag) != 2 {
+		t.Fatalf("unexpected tags:%+v", users)
+	}
+
+	//没有指定预加载时每行查询一次.
+	mock.ExpectQuery(`select post.id, post.title from post where id=1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(10, "p10").AddRow(11, "p11"))
+	mock.ExpectQuery(`select tag.id, tag.name from tag where id in \(select tag_id from post_tag_relation where post_id=\?\)`).WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(100, "go"))
+	mock.ExpectQuery(`select tag.id, tag.name from tag where id in \(select tag_id from post_tag_relation where post_id=\?\)`).WithArgs(11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var posts []preloadPost
+	if err = NewStmt(db, "post").Where("id=1").Query(&posts); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(posts) != 2 || len(posts[0].Tag) != 1 || len(posts[1].Tag) != 0 {
+		t.Fatalf("unexpected posts:%+v", posts)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestORMBatchInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	type user struct {
+		ID   int64 `db_auto:""`
+		User string
+	}
+
+	users := []user{{User: "a"}, {User: "b"}, {User: "c"}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\), \(\?\)`).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(10, 2))
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("c").WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectCommit()
+
+	ids, err := NewStmt(db, "userinfo").SetDialect(MySQL{ConsecutiveIDs: true}).BatchSize(2).BatchInsert(users)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(ids) != "[10 11 12]" {
+		t.Fatalf("unexpected mysql ids:%v", ids)
+	}
+
+	//mysql默认逐行插入获取准确的id.
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("a").WillReturnResult(sqlmock.NewResult(20, 1))
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("b").WillReturnResult(sqlmock.NewResult(22, 1))
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("c").WillReturnResult(sqlmock.NewResult(24, 1))
+	mock.ExpectCommit()
+
+	if ids, err = NewStmt(db, "userinfo").BatchInsert(users); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(ids) != "[20 22 24]" {
+		t.Fatalf("unexpected mysql default ids:%v", ids)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`insert into userinfo \(user\) values \(\$1\), \(\$2\), \(\$3\) returning "id"`).WithArgs("a", "b", "c").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectCommit()
+
+	if ids, err = NewStmt(db, "userinfo").SetDialect(PostgreSQL{}).BatchInsert(users); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Fatalf("unexpected postgres ids:%v", ids)
+	}
+
+	//不支持returning的sqlite逐行插入.
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("a").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("b").WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectExec(`insert into userinfo \(user\) values \(\?\)`).WithArgs("c").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+
+	if ids, err = NewStmt(db, "userinfo").SetDialect(SQLite{NoReturning: true}).BatchInsert([]interface{}{&users[0], users[1], &users[2]}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(ids) != "[5 6 7]" {
+		t.Fatalf("unexpected sqlite ids:%v", ids)
+	}
+
+	if _, err = NewStmt(db, "userinfo").BatchInsert(users[0]); err == nil {
+		t.Fatalf("expect slice error")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
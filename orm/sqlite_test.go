@@ -0,0 +1,70 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	//sqlite
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLite(t *testing.T) {
+	db, err := sql.Open(DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer db.Close()
+	//内存数据库每个连接独立.
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(`create table user_info (id integer primary key autoincrement, name text not null unique, age integer not null)`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	type userInfo struct {
+		ID   int64 `db_auto:""`
+		Name string
+		Age  int
+	}
+
+	stmt := func() *Stmt {
+		return NewStmt(db, "user_info").SetDialect(SQLite{})
+	}
+
+	id, err := stmt().Insert(&userInfo{Name: "a", Age: 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if id != 1 {
+		t.Fatalf("expect id 1, recv:%v", id)
+	}
+
+	ids, err := stmt().BatchInsert([]userInfo{{Name: "b", Age: 2}, {Name: "c", Age: 3}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Fatalf("expect ids [2 3], recv:%v", ids)
+	}
+
+	if _, err = stmt().Where("id = ?", 2).Update(&userInfo{Name: "b", Age: 20}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err = stmt().Upsert(&userInfo{Name: "c", Age: 30}, "name"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err = stmt().Where("id = ?", 1).Delete(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var users []userInfo
+	if err = stmt().Sort("id").Query(&users); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(users) != "[{2 b 20} {3 c 30}]" {
+		t.Fatalf("unexpected users:%v", users)
+	}
+}
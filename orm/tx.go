@@ -0,0 +1,97 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+// Executor *sql.DB, *sql.Tx及*Tx的公共接口, Stmt可以在事务中执行.
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txBeginner *sql.DB.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Tx 事务, 嵌套调用WithTx时使用savepoint.
+type Tx struct {
+	*sql.Tx
+	depth int
+}
+
+// WithTx 在事务中执行fn, fn返回错误或panic时回滚, 否则提交.
+// ex为*sql.DB时开启新事务, 为*Tx或*sql.Tx时使用savepoint, 只回滚fn中的修改.
+func WithTx(ctx context.Context, ex Executor, fn func(tx *Tx) error) error {
+	return WithTxOptions(ctx, ex, nil, fn)
+}
+
+// WithTxOptions 同WithTx, 可以指定隔离级别及只读, 嵌套调用时忽略opts.
+func WithTxOptions(ctx context.Context, ex Executor, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	switch v := ex.(type) {
+	case *Tx:
+		return v.savepoint(ctx, fn)
+	case *sql.Tx:
+		return (&Tx{Tx: v}).savepoint(ctx, fn)
+	case txBeginner:
+		st, err := v.BeginTx(ctx, opts)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return run(&Tx{Tx: st}, fn, st.Rollback, st.Commit)
+	}
+
+	return errors.Errorf("executor %T not support transaction", ex)
+}
+
+// savepoint 在当前事务中创建savepoint执行fn.
+func (tx *Tx) savepoint(ctx context.Context, fn func(tx *Tx) error) error {
+	child := &Tx{Tx: tx.Tx, depth: tx.depth + 1}
+	name := fmt.Sprintf("sp_%d", child.depth)
+
+	if _, err := tx.ExecContext(ctx, "savepoint "+name); err != nil {
+		return errors.Trace(err)
+	}
+
+	release := func() error {
+		_, err := tx.ExecContext(ctx, "release savepoint "+name)
+		return err
+	}
+	//rollback to之后savepoint仍然存在, 需要释放.
+	rollback := func() error {
+		if _, err := tx.ExecContext(ctx, "rollback to savepoint "+name); err != nil {
+			return err
+		}
+		return release()
+	}
+
+	return run(child, fn, rollback, release)
+}
+
+// run 执行fn, 出错或panic时回滚, panic回滚后继续抛出.
+func run(tx *Tx, fn func(tx *Tx) error, rollback, commit func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if re := rollback(); re != nil {
+			return errors.Annotatef(err, "rollback:%v", re)
+		}
+		return err
+	}
+
+	return errors.Trace(commit())
+}
@@ -0,0 +1,103 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/juju/errors"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+type txUser struct {
+	ID   int64 `db_auto:""`
+	User string
+}
+
+func TestWithTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into userinfo").WithArgs("a").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("savepoint sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into userinfo").WithArgs("b").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("rollback to savepoint sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("release savepoint sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("savepoint sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update `userinfo` set").WithArgs("c", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("release savepoint sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	errNested := errors.New("nested failed")
+
+	err = WithTxOptions(context.Background(), db, &sql.TxOptions{Isolation: sql.LevelDefault}, func(tx *Tx) error {
+		id, err := NewStmt(tx, "userinfo").Insert(&txUser{User: "a"})
+		if err != nil {
+			return err
+		}
+
+		//嵌套事务失败只回滚到savepoint.
+		err = WithTx(context.Background(), tx, func(tx *Tx) error {
+			if _, err := NewStmt(tx, "userinfo").Insert(&txUser{User: "b"}); err != nil {
+				return err
+			}
+			return errNested
+		})
+		if err != errNested {
+			t.Fatalf("expect nested error, recv:%v", err)
+		}
+
+		return WithTx(context.Background(), tx, func(tx *Tx) error {
+			_, err := NewStmt(tx, "userinfo").Where("id = ?", id).Update(&struct{ User string }{User: "c"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into userinfo").WillReturnError(errors.New("duplicate"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = WithTx(context.Background(), db, func(tx *Tx) error {
+		_, err := NewStmt(tx, "userinfo").Insert(&txUser{User: "a"})
+		return err
+	})
+	if err == nil {
+		t.Fatalf("expect insert error")
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("expect panic boom, recv:%v", p)
+			}
+		}()
+		WithTx(context.Background(), db, func(tx *Tx) error {
+			panic("boom")
+		})
+	}()
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err.Error())
+	}
+}